@@ -0,0 +1,249 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// aegisSlotPassword is the type of a key slot in an Aegis vault protected by a password.
+const aegisSlotPassword = 1
+
+// The upper bounds of the scrypt parameters in an Aegis key slot. Aegis itself uses N = 2^15, r = 8, and p = 1, while
+// the memory scrypt allocates grows with N * r and the work with N * r * p, so a forged vault could otherwise exhaust
+// the memory of the process.
+const (
+	aegisScryptNMax  = 1 << 20
+	aegisScryptRPMax = 16
+)
+
+// aegisVault is the JSON representation of a vault Aegis Authenticator exports.
+type aegisVault struct {
+	Version int `json:"version"`
+	Header  struct {
+		Slots  []aegisSlot  `json:"slots"`
+		Params *aegisParams `json:"params"`
+	} `json:"header"`
+	// DB is a JSON object of a plaintext vault, or a Base64 string of an encrypted one.
+	DB json.RawMessage `json:"db"`
+}
+
+// aegisSlot is a key slot holding the master key of an Aegis vault encrypted with a key derived from a password.
+type aegisSlot struct {
+	Type      int         `json:"type"`
+	Key       string      `json:"key"`
+	KeyParams aegisParams `json:"key_params"`
+	N         int         `json:"n"`
+	R         int         `json:"r"`
+	P         int         `json:"p"`
+	Salt      string      `json:"salt"`
+}
+
+// aegisParams holds the parameters of AES-GCM in an Aegis vault.
+type aegisParams struct {
+	Nonce string `json:"nonce"`
+	Tag   string `json:"tag"`
+}
+
+// aegisDB is the JSON representation of the entries in an Aegis vault.
+type aegisDB struct {
+	Version int          `json:"version"`
+	Entries []aegisEntry `json:"entries"`
+}
+
+// aegisEntry is the JSON representation of an entry in an Aegis vault.
+type aegisEntry struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Issuer string `json:"issuer"`
+	Info   struct {
+		Secret  string `json:"secret"`
+		Algo    string `json:"algo"`
+		Digits  int    `json:"digits"`
+		Period  int    `json:"period"`
+		Counter uint64 `json:"counter"`
+	} `json:"info"`
+}
+
+// ParseAegis returns the tokens in a vault Aegis Authenticator exports as JSON. A plaintext vault is parsed with an
+// empty `password`. An encrypted vault is decrypted with `password` as Aegis does: the master key is decrypted from a
+// password slot with a key derived by scrypt, and then the entries are decrypted with the master key, both with
+// AES-256-GCM.
+//
+// Entries of type "totp", "hotp", and "steam" are supported. Steam entries render OTPs as Steam Guard codes.
+// The same validation rules as NewToken are applied to each entry, and the returned error tells the index of the
+// offending one. An error on the structure of `data` or a wrong password wraps ErrInvalidBackup, and so do scrypt
+// parameters beyond N = 2^20 or r * p = 16, which are rejected before deriving a key to bound the memory used.
+func ParseAegis(data []byte, password string) ([]*Token, error) {
+	var vault aegisVault
+	if err := json.Unmarshal(data, &vault); err != nil {
+		return nil, errorf(ErrInvalidBackup, "Failed to parse Aegis vault: %v", err)
+	}
+	if len(vault.DB) == 0 {
+		return nil, errorf(ErrInvalidBackup, "Aegis vault has no entries")
+	}
+
+	plaintext := []byte(vault.DB)
+	if vault.Header.Params != nil {
+		if password == "" {
+			return nil, errorf(ErrInvalidBackup, "Aegis vault is encrypted, but password is empty")
+		}
+		var encoded string
+		if err := json.Unmarshal(vault.DB, &encoded); err != nil {
+			return nil, errorf(ErrInvalidBackup, "Encrypted Aegis vault have to hold a Base64 string")
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errorf(ErrInvalidBackup, "Encrypted Aegis vault cannot be decoded as Base64")
+		}
+		masterKey, err := aegisMasterKey(vault.Header.Slots, password)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			for i := range masterKey {
+				masterKey[i] = 0
+			}
+		}()
+		plaintext, err = aegisDecrypt(masterKey, *vault.Header.Params, ciphertext)
+		if err != nil {
+			return nil, errorf(ErrInvalidBackup, "Failed to decrypt Aegis vault")
+		}
+		defer func() {
+			for i := range plaintext {
+				plaintext[i] = 0
+			}
+		}()
+	}
+
+	var db aegisDB
+	if err := json.Unmarshal(plaintext, &db); err != nil {
+		return nil, errorf(ErrInvalidBackup, "Failed to parse entries of Aegis vault: %v", err)
+	}
+	tokens := make([]*Token, 0, len(db.Entries))
+	for i, e := range db.Entries {
+		t, err := parseAegisEntry(e)
+		if err != nil {
+			return nil, fmt.Errorf("Entry at index %v: %w", i, err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// aegisMasterKey returns the master key of an Aegis vault decrypted from the first password slot `password` opens.
+func aegisMasterKey(slots []aegisSlot, password string) ([]byte, error) {
+	found := false
+	for _, s := range slots {
+		if s.Type != aegisSlotPassword {
+			continue
+		}
+		found = true
+		salt, err := hex.DecodeString(s.Salt)
+		if err != nil {
+			return nil, errorf(ErrInvalidBackup, "Salt of Aegis key slot cannot be decoded as hex")
+		}
+		encryptedKey, err := hex.DecodeString(s.Key)
+		if err != nil {
+			return nil, errorf(ErrInvalidBackup, "Key of Aegis key slot cannot be decoded as hex")
+		}
+		if s.N > aegisScryptNMax || s.R <= 0 || s.P <= 0 || s.R > aegisScryptRPMax/s.P {
+			return nil, errorf(ErrInvalidBackup, "Scrypt parameters of Aegis key slot have to be N <= %v and r * p <= %v. "+
+				"Got N = %v, r = %v, p = %v", aegisScryptNMax, aegisScryptRPMax, s.N, s.R, s.P)
+		}
+		key, err := scrypt.Key([]byte(password), salt, s.N, s.R, s.P, 32)
+		if err != nil {
+			return nil, errorf(ErrInvalidBackup, "Invalid scrypt parameters in Aegis key slot: %v", err)
+		}
+		masterKey, err := aegisDecrypt(key, s.KeyParams, encryptedKey)
+		for i := range key {
+			key[i] = 0
+		}
+		// The password might be for another slot.
+		if err == nil {
+			return masterKey, nil
+		}
+	}
+	if !found {
+		return nil, errorf(ErrInvalidBackup, "Aegis vault has no password slot")
+	}
+	return nil, errorf(ErrInvalidBackup, "Password is wrong")
+}
+
+// aegisDecrypt decrypts `ciphertext` with `key` and the nonce and the tag in `params` by AES-GCM.
+func aegisDecrypt(key []byte, params aegisParams, ciphertext []byte) ([]byte, error) {
+	nonce, err := hex.DecodeString(params.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := hex.DecodeString(params.Tag)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(nonce))
+	if err != nil {
+		return nil, err
+	}
+	if len(tag) != gcm.Overhead() {
+		return nil, fmt.Errorf("Tag have to be %v bytes long. Got %v bytes", gcm.Overhead(), len(tag))
+	}
+	// Aegis stores the tag apart from the ciphertext, while Open expects it appended.
+	sealed := make([]byte, 0, len(ciphertext)+len(tag))
+	sealed = append(sealed, ciphertext...)
+	sealed = append(sealed, tag...)
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+// parseAegisEntry returns a Token from an entry in an Aegis vault.
+func parseAegisEntry(e aegisEntry) (*Token, error) {
+	secret, err := decodeSecret(e.Info.Secret)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for i := range secret {
+			secret[i] = 0
+		}
+	}()
+
+	opts := []Option{WithLabel(e.Name), WithIssuer(e.Issuer)}
+	if e.Info.Algo != "" {
+		opts = append(opts, WithAlgorithm(e.Info.Algo))
+	}
+	if e.Info.Period != 0 {
+		opts = append(opts, WithPeriod(e.Info.Period))
+	}
+	typ := typeTOTP
+	switch e.Type {
+	case typeTOTP:
+	case typeHOTP:
+		typ = typeHOTP
+	case "steam":
+		// Steam Guard codes don't have decimal digits.
+		opts = append(opts, WithAlphabet(steamAlphabet, steamLength))
+	default:
+		return nil, errorf(ErrInvalidHost, "Type have to be \"totp\", \"hotp\", or \"steam\". Got %q", e.Type)
+	}
+	if e.Type != "steam" && e.Info.Digits != 0 {
+		opts = append(opts, WithDigits(e.Info.Digits))
+	}
+
+	t, err := NewTokenFromParams(secret, opts...)
+	if err != nil {
+		return nil, err
+	}
+	t.typ = typ
+	if typ == typeHOTP {
+		t.counter = e.Info.Counter
+	}
+	return t, nil
+}
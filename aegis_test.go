@@ -0,0 +1,141 @@
+package totp
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// The vaults hold the same entries, and the encrypted one is protected by the password "test".
+var aegisExpected = []string{
+	"otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&algorithm=SHA1&digits=6&period=30",
+	"otpauth://hotp/bob@example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Example&algorithm=SHA256&digits=8&counter=5",
+	"otpauth://totp/carol?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Steam&algorithm=SHA1&digits=6&period=30",
+}
+
+func TestParseAegis(t *testing.T) {
+	cases := []struct {
+		desc     string
+		path     string
+		password string
+	}{
+		{"Plaintext vault should be parsed without password", "testdata/aegis_plain.json", ""},
+		{"Plaintext vault should be parsed ignoring password", "testdata/aegis_plain.json", "test"},
+		{"Encrypted vault should be decrypted with password", "testdata/aegis_encrypted.json", "test"},
+	}
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	for _, c := range cases {
+		data, err := os.ReadFile(c.path)
+		if err != nil {
+			t.Fatalf("Failed to read %v: %v", c.path, err)
+		}
+		tokens, err := ParseAegis(data, c.password)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if len(tokens) != len(aegisExpected) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected %v tokens. Got %v", len(aegisExpected), len(tokens))
+			continue
+		}
+		for i, tk := range tokens {
+			if tk.String() != aegisExpected[i] {
+				t.Errorf("[CASE] %v", c.desc)
+				t.Errorf("Expected: %q, Actual: %q", aegisExpected[i], tk.String())
+			}
+		}
+		// Steam entries render Steam Guard codes.
+		if steam := tokens[2]; steam.Generate(tm) != steam.GenerateSteam(tm) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", steam.GenerateSteam(tm), steam.Generate(tm))
+		}
+	}
+}
+
+func TestParseAegisErrors(t *testing.T) {
+	encrypted, err := os.ReadFile("testdata/aegis_encrypted.json")
+	if err != nil {
+		t.Fatalf("Failed to read vault: %v", err)
+	}
+	cases := []struct {
+		desc     string
+		data     string
+		password string
+		err      error
+	}{
+		{
+			desc:     "Wrong password should be rejected",
+			data:     string(encrypted),
+			password: "wrong",
+			err:      ErrInvalidBackup,
+		},
+		{
+			desc:     "Encrypted vault without password should be rejected",
+			data:     string(encrypted),
+			password: "",
+			err:      ErrInvalidBackup,
+		},
+		{
+			desc: "Malformed JSON should be rejected",
+			data: `{"version":1,"header":`,
+			err:  ErrInvalidBackup,
+		},
+		{
+			desc: "Vault without db should be rejected",
+			data: `{"version":1,"header":{"slots":null,"params":null}}`,
+			err:  ErrInvalidBackup,
+		},
+		{
+			desc:     "Encrypted vault without password slot should be rejected",
+			data:     `{"version":1,"header":{"slots":[],"params":{"nonce":"00","tag":"00"}},"db":"AAAA"}`,
+			password: "test",
+			err:      ErrInvalidBackup,
+		},
+		{
+			desc:     "Huge scrypt N should be rejected",
+			data:     `{"version":1,"header":{"slots":[{"type":1,"key":"00","key_params":{"nonce":"00","tag":"00"},"n":1099511627776,"r":1,"p":1,"salt":"00"}],"params":{"nonce":"00","tag":"00"}},"db":"AAAA"}`,
+			password: "test",
+			err:      ErrInvalidBackup,
+		},
+		{
+			desc:     "Huge scrypt r * p should be rejected",
+			data:     `{"version":1,"header":{"slots":[{"type":1,"key":"00","key_params":{"nonce":"00","tag":"00"},"n":32768,"r":8,"p":4,"salt":"00"}],"params":{"nonce":"00","tag":"00"}},"db":"AAAA"}`,
+			password: "test",
+			err:      ErrInvalidBackup,
+		},
+		{
+			desc:     "Non-positive scrypt r should be rejected",
+			data:     `{"version":1,"header":{"slots":[{"type":1,"key":"00","key_params":{"nonce":"00","tag":"00"},"n":32768,"r":0,"p":1,"salt":"00"}],"params":{"nonce":"00","tag":"00"}},"db":"AAAA"}`,
+			password: "test",
+			err:      ErrInvalidBackup,
+		},
+		{
+			desc: "Unsupported type should be rejected",
+			data: `{"version":1,"header":{"slots":null,"params":null},"db":{"version":2,"entries":[{"type":"motp","name":"alice","info":{"secret":"JBSWY3DPEHPK3PXP"}}]}}`,
+			err:  ErrInvalidHost,
+		},
+		{
+			desc: "Invalid secret should be rejected",
+			data: `{"version":1,"header":{"slots":null,"params":null},"db":{"version":2,"entries":[{"type":"totp","name":"alice","info":{"secret":"01010101"}}]}}`,
+			err:  ErrInvalidSecret,
+		},
+		{
+			desc: "Unknown algorithm should be rejected",
+			data: `{"version":1,"header":{"slots":null,"params":null},"db":{"version":2,"entries":[{"type":"totp","name":"alice","info":{"secret":"JBSWY3DPEHPK3PXP","algo":"MD5"}}]}}`,
+			err:  ErrInvalidAlgorithm,
+		},
+	}
+	for _, c := range cases {
+		_, err := ParseAegis([]byte(c.data), c.password)
+		if !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package totp
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ParseURIs reads Key URIs from `r`, one per line, and parses each of them by NewToken with `opts`. Blank lines and
+// lines starting with "#" are skipped, and leading and trailing spaces are ignored.
+//
+// It returns the tokens parsed successfully in the order of the lines, together with an error for each line that
+// failed. The errors tell the line numbers and wrap the ones returned by NewToken. An error reading `r` is appended
+// last, after which no more lines are read.
+func ParseURIs(r io.Reader, opts ...Option) ([]*Token, []error) {
+	var tokens []*Token
+	var errs []error
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		t, err := NewToken(line, opts...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Line %v: %w", n, err))
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	if err := s.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("Failed to read Key URIs: %w", err))
+	}
+	return tokens, errs
+}
+
+// GenerateAll returns TOTP values for a specified time generated by each of `tokens`, in the same order. The value for
+// a nil token is an empty string.
+func GenerateAll(tokens []*Token, m time.Time) []string {
+	codes := make([]string, len(tokens))
+	for i, t := range tokens {
+		if t != nil {
+			codes[i] = t.Generate(m)
+		}
+	}
+	return codes
+}
+
+// VerifyAny reports whether `code` matches the TOTP value of any of `tokens` for a specified time within `skew` steps
+// as VerifyWithSkew does, and returns the first matching token. It is meant for authentication without knowing which
+// account the code belongs to.
+//
+// Returning as soon as a token matched would leak through timing which of the tokens the code belongs to, so every
+// token and every step in the window are evaluated regardless of matches, and the result is selected in constant time.
+// The time VerifyAny takes thus depends only on the number of tokens and `skew`. Nil tokens never match.
+func VerifyAny(tokens []*Token, code string, m time.Time, skew int) (*Token, bool) {
+	found, index := 0, 0
+	for i, t := range tokens {
+		if t == nil {
+			continue
+		}
+		match := t.matchAll(code, m, skew)
+		// Select the first match only.
+		index = subtle.ConstantTimeSelect(match&^found, i, index)
+		found |= match
+	}
+	if found == 0 {
+		return nil, false
+	}
+	return tokens[index], true
+}
@@ -0,0 +1,169 @@
+package totp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseURIs(t *testing.T) {
+	input := strings.Join([]string{
+		"# Exported accounts",
+		"otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example",
+		"",
+		"   otpauth://hotp/Example:bob@google.com?secret=JBSWY3DPEHPK3PXP&counter=1   ",
+		"otpauth://totp/Example:carol@google.com",
+		"  # Indented comment",
+		"otpauth://totp/Example:dave@google.com?secret=JBSWY3DPEHPK3PXP&digits=12",
+	}, "\n")
+
+	tokens, errs := ParseURIs(strings.NewReader(input))
+	labels := []string{"Example:alice@google.com", "Example:bob@google.com"}
+	if len(tokens) != len(labels) {
+		t.Fatalf("Expected %v tokens. Got %v", len(labels), len(tokens))
+	}
+	for i, tk := range tokens {
+		if tk.Label() != labels[i] {
+			t.Errorf("Expected: %q, Actual: %q", labels[i], tk.Label())
+		}
+	}
+
+	expected := []struct {
+		prefix string
+		err    error
+	}{
+		{"Line 5: ", ErrMissingSecret},
+		{"Line 7: ", ErrDigitsOutOfRange},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %v errors. Got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if !strings.HasPrefix(err.Error(), expected[i].prefix) || !errors.Is(err, expected[i].err) {
+			t.Errorf("Expected: %q and %v, Actual: %v", expected[i].prefix, expected[i].err, err)
+		}
+	}
+
+	// Options should be applied to every line.
+	tokens, errs = ParseURIs(strings.NewReader(input), WithMaxDigits(12))
+	if len(tokens) != 3 || len(errs) != 1 {
+		t.Errorf("Expected 3 tokens and 1 error. Got %v tokens and %v", len(tokens), errs)
+	}
+}
+
+func TestGenerateAll(t *testing.T) {
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	var tokens []*Token
+	for _, uri := range []string{
+		"otpauth://totp/Example:alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8",
+		"otpauth://totp/Example:bob@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+	} {
+		tk, err := NewToken(uri)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		tokens = append(tokens, tk)
+	}
+	tokens = append(tokens, nil)
+
+	expected := []string{"89005924", "005924", ""}
+	codes := GenerateAll(tokens, tm)
+	if strings.Join(codes, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected: %q, Actual: %q", expected, codes)
+	}
+}
+
+func TestVerifyAny(t *testing.T) {
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	var tokens []*Token
+	for _, uri := range []string{
+		"otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://totp/Example:bob@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"otpauth://totp/Example:carol@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+	} {
+		tk, err := NewToken(uri)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		tokens = append(tokens, tk)
+	}
+	tokens = append([]*Token{nil}, tokens...)
+
+	cases := []struct {
+		desc     string
+		code     string
+		skew     int
+		expected *Token
+	}{
+		{
+			desc:     "Code of a token should return the token",
+			code:     tokens[1].Generate(tm),
+			expected: tokens[1],
+		},
+		{
+			desc:     "First matching token should be returned",
+			code:     tokens[2].Generate(tm),
+			expected: tokens[2],
+		},
+		{
+			desc:     "Code of the previous step should match within the skew",
+			code:     tokens[1].Generate(tm.Add(-30 * time.Second)),
+			skew:     1,
+			expected: tokens[1],
+		},
+		{
+			desc: "Code of the previous step should not match without skew",
+			code: tokens[1].Generate(tm.Add(-30 * time.Second)),
+		},
+		{
+			desc: "Wrong code should not match",
+			code: "000000",
+		},
+	}
+	for _, c := range cases {
+		tk, ok := VerifyAny(tokens, c.code, tm, c.skew)
+		if tk != c.expected || ok != (c.expected != nil) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%v, %v), Actual: (%v, %v)", c.expected, c.expected != nil, tk, ok)
+		}
+	}
+}
+
+func TestVerifyAnyWithDestroyedToken(t *testing.T) {
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	alice, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	bob, err := NewToken("otpauth://totp/Example:bob@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	bob.Destroy()
+	tokens := []*Token{alice, bob}
+
+	cases := []struct {
+		desc string
+		code string
+	}{
+		{"Empty code should not match a destroyed token", ""},
+		{"Wrong code should not match a destroyed token", "000000"},
+		{"Code of another length should not match", alice.Generate(tm) + "0"},
+	}
+	for _, c := range cases {
+		if tk, ok := VerifyAny(tokens, c.code, tm, 1); tk != nil || ok {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%v, %v), Actual: (%v, %v)", nil, false, tk, ok)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package totp
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock provides the current time to a Token.
+// It is useful to control the time in tests of code depending on this package.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is a Clock returning the current local time.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a Clock whose time only changes when told to, which drives tokens deterministically in tests.
+// It is safe for concurrent use.
+type FakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewFakeClock returns a FakeClock whose current time is `t`.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Advance moves the current time of the clock forward by `d`, or backward when `d` is negative.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// Set sets the current time of the clock to `t`.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
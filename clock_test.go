@@ -0,0 +1,59 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	clock := NewFakeClock(tm)
+	if !clock.Now().Equal(tm) {
+		t.Errorf("Expected: %v, Actual: %v", tm, clock.Now())
+	}
+	clock.Advance(90 * time.Second)
+	if expected := tm.Add(90 * time.Second); !clock.Now().Equal(expected) {
+		t.Errorf("Expected: %v, Actual: %v", expected, clock.Now())
+	}
+	clock.Advance(-time.Minute)
+	if expected := tm.Add(30 * time.Second); !clock.Now().Equal(expected) {
+		t.Errorf("Expected: %v, Actual: %v", expected, clock.Now())
+	}
+	clock.Set(tm)
+	if !clock.Now().Equal(tm) {
+		t.Errorf("Expected: %v, Actual: %v", tm, clock.Now())
+	}
+}
+
+func TestFakeClockAcrossPeriodBoundary(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	clock := NewFakeClock(tm)
+	tk.WithClock(clock)
+
+	// The values are from Appendix B of RFC 6238.
+	steps := []struct {
+		advance time.Duration
+		otp     string
+	}{
+		{0, "07081804"},
+		{999 * time.Millisecond, "07081804"},
+		{time.Millisecond, "14050471"},
+		{29 * time.Second, "14050471"},
+	}
+	for _, s := range steps {
+		clock.Advance(s.advance)
+		if otp := tk.Now(); otp != s.otp {
+			t.Errorf("OTP didn't match for %v. Expected: %q, Actual: %q", clock.Now().Format(time.RFC3339Nano), s.otp, otp)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package totp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by NewToken and other constructors. They are wrapped in errors with descriptive messages, so use
+// errors.Is to check for them.
+var (
+	ErrInvalidURI         = errors.New("Invalid URI")
+	ErrInvalidScheme      = errors.New("Invalid scheme")
+	ErrInvalidHost        = errors.New("Invalid host")
+	ErrMissingSecret      = errors.New("Missing secret")
+	ErrInvalidSecret      = errors.New("Invalid secret")
+	ErrSecretTooShort     = errors.New("Secret too short")
+	ErrIssuerMismatch     = errors.New("Issuer mismatch")
+	ErrInvalidAlgorithm   = errors.New("Invalid algorithm")
+	ErrInvalidDigits      = errors.New("Invalid digits")
+	ErrDigitsOutOfRange   = errors.New("Digits out of range")
+	ErrMissingCounter     = errors.New("Missing counter")
+	ErrInvalidCounter     = errors.New("Invalid counter")
+	ErrInvalidPeriod      = errors.New("Invalid period")
+	ErrPeriodOutOfRange   = errors.New("Period out of range")
+	ErrInvalidImage       = errors.New("Invalid image")
+	ErrUnknownParameter   = errors.New("Unknown parameter")
+	ErrDuplicateParameter = errors.New("Duplicate parameter")
+	ErrInvalidMigration   = errors.New("Invalid migration payload")
+	ErrInvalidBackup      = errors.New("Invalid backup")
+)
+
+// A ParseError describes a violation found in a Key URI by NewToken, or in query parameters by NewTokenFromValues.
+type ParseError struct {
+	Field string // The part of the Key URI violating the spec, e.g. "scheme", "secret", or "digits"
+	Value string // The offending value as it appears in the Key URI, which is empty when the field is absent
+	URI   string // The Key URI passed to NewToken, which is empty for NewTokenFromValues
+	Err   error  // The reason, which wraps one of the errors above
+}
+
+func (e *ParseError) Error() string {
+	// Parameters given without a Key URI, e.g. by NewTokenFromValues, have no URI to tell.
+	if e.URI == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v. URI: %q", e.Err, e.URI)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// detailedError is an error with a descriptive message wrapping one of the errors above.
+type detailedError struct {
+	msg string
+	err error
+}
+
+func (e *detailedError) Error() string {
+	return e.msg
+}
+
+func (e *detailedError) Unwrap() error {
+	return e.err
+}
+
+// errorf returns an error wrapping `err` whose message is formatted according to `format`.
+func errorf(err error, format string, a ...interface{}) error {
+	return &detailedError{fmt.Sprintf(format, a...), err}
+}
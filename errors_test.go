@@ -0,0 +1,189 @@
+package totp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSentinelErrorsInNewToken(t *testing.T) {
+	cases := []struct {
+		desc string
+		uri  string
+		opts []Option
+		err  error
+	}{
+		{
+			desc: "Invalid URI should wrap ErrInvalidURI",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=\t",
+			err:  ErrInvalidURI,
+		},
+		{
+			desc: "Invalid scheme should wrap ErrInvalidScheme",
+			uri:  "http://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			err:  ErrInvalidScheme,
+		},
+		{
+			desc: "Invalid host should wrap ErrInvalidHost",
+			uri:  "otpauth://motp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			err:  ErrInvalidHost,
+		},
+		{
+			desc: "Missing secret should wrap ErrMissingSecret",
+			uri:  "otpauth://totp/exampleservice:exampleuser",
+			err:  ErrMissingSecret,
+		},
+		{
+			desc: "Empty secret should wrap ErrInvalidSecret",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=",
+			err:  ErrInvalidSecret,
+		},
+		{
+			desc: "Invalid secret should wrap ErrInvalidSecret",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=01010101010101010101010101010101",
+			err:  ErrInvalidSecret,
+		},
+		{
+			desc: "Short secret should wrap ErrSecretTooShort",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			opts: []Option{WithMinSecretBits(256)},
+			err:  ErrSecretTooShort,
+		},
+		{
+			desc: "Issuer mismatch should wrap ErrIssuerMismatch",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=otherservice",
+			err:  ErrIssuerMismatch,
+		},
+		{
+			desc: "Invalid algorithm should wrap ErrInvalidAlgorithm",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=MD5",
+			err:  ErrInvalidAlgorithm,
+		},
+		{
+			desc: "Non-integer digits should wrap ErrInvalidDigits",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=foo",
+			err:  ErrInvalidDigits,
+		},
+		{
+			desc: "Digits out of range should wrap ErrDigitsOutOfRange",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=11",
+			err:  ErrDigitsOutOfRange,
+		},
+		{
+			desc: "Missing counter should wrap ErrMissingCounter",
+			uri:  "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			err:  ErrMissingCounter,
+		},
+		{
+			desc: "Invalid counter should wrap ErrInvalidCounter",
+			uri:  "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=-1",
+			err:  ErrInvalidCounter,
+		},
+		{
+			desc: "Non-integer period should wrap ErrInvalidPeriod",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&period=foo",
+			err:  ErrInvalidPeriod,
+		},
+		{
+			desc: "Period out of range should wrap ErrPeriodOutOfRange",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&period=91",
+			err:  ErrPeriodOutOfRange,
+		},
+	}
+	for _, c := range cases {
+		_, err := NewToken(c.uri, c.opts...)
+		if !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected an error wrapping %q. Got: %v", c.err, err)
+		}
+	}
+}
+
+func TestSentinelErrorsInOptions(t *testing.T) {
+	cases := []struct {
+		desc string
+		opt  Option
+		err  error
+	}{
+		{"Invalid algorithm should wrap ErrInvalidAlgorithm", WithAlgorithm("MD5"), ErrInvalidAlgorithm},
+		{"Digits out of range should wrap ErrDigitsOutOfRange", WithDigits(11), ErrDigitsOutOfRange},
+		{"Period out of range should wrap ErrPeriodOutOfRange", WithPeriod(91), ErrPeriodOutOfRange},
+		{"Short secret should wrap ErrSecretTooShort", WithMinSecretBits(256), ErrSecretTooShort},
+	}
+	for _, c := range cases {
+		_, err := NewTokenFromParams([]byte("12345678901234567890"), c.opt)
+		if !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected an error wrapping %q. Got: %v", c.err, err)
+		}
+	}
+
+	if _, err := NewTokenFromParams(nil); !errors.Is(err, ErrMissingSecret) {
+		t.Errorf("Expected an error wrapping %q. Got: %v", ErrMissingSecret, err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	cases := []struct {
+		desc  string
+		uri   string
+		field string
+		value string
+	}{
+		{
+			desc:  "Invalid scheme should be reported",
+			uri:   "http://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			field: "scheme",
+			value: "http",
+		},
+		{
+			desc:  "Missing secret should be reported with an empty value",
+			uri:   "otpauth://totp/exampleservice:exampleuser",
+			field: "secret",
+			value: "",
+		},
+		{
+			desc:  "Invalid secret should be reported",
+			uri:   "otpauth://totp/exampleservice:exampleuser?secret=01010101",
+			field: "secret",
+			value: "01010101",
+		},
+		{
+			desc:  "Invalid digits should be reported",
+			uri:   "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=11",
+			field: "digits",
+			value: "11",
+		},
+		{
+			desc:  "Invalid period should be reported",
+			uri:   "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&period=foo",
+			field: "period",
+			value: "foo",
+		},
+	}
+	for _, c := range cases {
+		_, err := NewToken(c.uri)
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected a *ParseError. Got: %v", err)
+			continue
+		}
+		if pe.Field != c.field || pe.Value != c.value || pe.URI != c.uri {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%q, %q, %q), Actual: (%q, %q, %q)", c.field, c.value, c.uri, pe.Field, pe.Value, pe.URI)
+		}
+		if pe.Err == nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Error("Reason is missing")
+		}
+	}
+}
+
+func TestParseErrorWithInvalidOptions(t *testing.T) {
+	// Errors on options don't concern the Key URI.
+	_, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", WithDigits(3))
+	var pe *ParseError
+	if !errors.Is(err, ErrDigitsOutOfRange) || errors.As(err, &pe) {
+		t.Errorf("Expected: %v without a *ParseError, Actual: %#v", ErrDigitsOutOfRange, err)
+	}
+}
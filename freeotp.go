@@ -0,0 +1,133 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// freeOTPToken is the JSON representation of a token in a FreeOTP backup.
+type freeOTPToken struct {
+	Type      string          `json:"type"`
+	Label     string          `json:"label"`
+	IssuerExt string          `json:"issuerExt"`
+	IssuerInt string          `json:"issuerInt"`
+	Algo      string          `json:"algo"`
+	Digits    int             `json:"digits"`
+	Period    int             `json:"period"`
+	Counter   uint64          `json:"counter"`
+	Secret    json.RawMessage `json:"secret"`
+}
+
+// ParseFreeOTP returns the tokens in a FreeOTP backup, which is a JSON object holding them in `tokens` or a bare JSON
+// array of them. FreeOTP stores a secret as an array of signed bytes, e.g. `[72, 101, -34, -83]`, but a Base32 string
+// is also accepted. Absent fields have the same default values as NewToken.
+//
+// The same validation rules as NewToken are applied to each token, and the returned error tells the index of the
+// offending one. An error on the structure of `data` wraps ErrInvalidBackup.
+func ParseFreeOTP(data []byte) ([]*Token, error) {
+	var entries []freeOTPToken
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, errorf(ErrInvalidBackup, "Failed to parse FreeOTP backup: %v", err)
+		}
+	} else {
+		var v struct {
+			Tokens []freeOTPToken `json:"tokens"`
+		}
+		if err := json.Unmarshal(trimmed, &v); err != nil {
+			return nil, errorf(ErrInvalidBackup, "Failed to parse FreeOTP backup: %v", err)
+		}
+		entries = v.Tokens
+	}
+
+	tokens := make([]*Token, 0, len(entries))
+	for i, e := range entries {
+		t, err := parseFreeOTPToken(e)
+		if err != nil {
+			return nil, fmt.Errorf("Token at index %v: %w", i, err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// parseFreeOTPToken returns a Token from a token in a FreeOTP backup.
+func parseFreeOTPToken(e freeOTPToken) (*Token, error) {
+	typ := typeTOTP
+	switch strings.ToLower(e.Type) {
+	case "", typeTOTP:
+	case typeHOTP:
+		typ = typeHOTP
+	default:
+		return nil, errorf(ErrInvalidHost, "Type have to be \"TOTP\" or \"HOTP\". Got %q", e.Type)
+	}
+
+	secret, err := decodeFreeOTPSecret(e.Secret)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for i := range secret {
+			secret[i] = 0
+		}
+	}()
+
+	// The issuer edited by the user takes precedence over the one from the Key URI.
+	issuer := e.IssuerExt
+	if issuer == "" {
+		issuer = e.IssuerInt
+	}
+	opts := []Option{WithLabel(e.Label), WithIssuer(issuer)}
+	if e.Algo != "" {
+		opts = append(opts, WithAlgorithm(e.Algo))
+	}
+	if e.Digits != 0 {
+		opts = append(opts, WithDigits(e.Digits))
+	}
+	if e.Period != 0 {
+		opts = append(opts, WithPeriod(e.Period))
+	}
+	t, err := NewTokenFromParams(secret, opts...)
+	if err != nil {
+		return nil, err
+	}
+	t.typ = typ
+	if typ == typeHOTP {
+		t.counter = e.Counter
+	}
+	return t, nil
+}
+
+// decodeFreeOTPSecret decodes a secret in a FreeOTP backup, which is either an array of signed bytes or a Base32
+// string.
+func decodeFreeOTPSecret(raw json.RawMessage) ([]byte, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, errorf(ErrMissingSecret, "Secret is required")
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errorf(ErrInvalidSecret, "Failed to parse secret: %v", err)
+		}
+		return decodeSecret(s)
+	}
+
+	var values []int
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, errorf(ErrInvalidSecret, "Secret have to be an array of bytes or a Base32 string")
+	}
+	if len(values) == 0 {
+		return nil, errorf(ErrMissingSecret, "Secret is empty")
+	}
+	secret := make([]byte, len(values))
+	for i, v := range values {
+		// Java bytes are signed, but unsigned ones are accepted as well.
+		if v < -128 || v > 255 {
+			return nil, errorf(ErrInvalidSecret, "Secret have to consist of bytes. Got %v at index %v", v, i)
+		}
+		secret[i] = byte(v)
+	}
+	return secret, nil
+}
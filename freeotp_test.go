@@ -0,0 +1,118 @@
+package totp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFreeOTP(t *testing.T) {
+	// The secret of alice is "JBSWY3DPEHPK3PXP", and the one of bob is "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ".
+	alice := `{"algo":"SHA1","counter":0,"digits":6,"issuerExt":"Example","issuerInt":"example.com","label":"alice@google.com","period":30,"secret":[72,101,108,108,111,33,-34,-83,-66,-17],"type":"TOTP"}`
+	bob := `{"algo":"SHA256","counter":5,"digits":8,"issuerInt":"Example","label":"bob@example.com","secret":"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ","type":"HOTP"}`
+	expected := []string{
+		"otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&algorithm=SHA1&digits=6&period=30",
+		"otpauth://hotp/bob@example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Example&algorithm=SHA256&digits=8&counter=5",
+	}
+	cases := []struct {
+		desc string
+		data string
+	}{
+		{
+			desc: "Object holding tokens should be parsed",
+			data: `{"tokenOrder":["Example:alice@google.com","Example:bob@example.com"],"tokens":[` + alice + `,` + bob + `]}`,
+		},
+		{
+			desc: "Bare array of tokens should be parsed",
+			data: ` [` + alice + `,` + bob + `]`,
+		},
+	}
+	for _, c := range cases {
+		tokens, err := ParseFreeOTP([]byte(c.data))
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if len(tokens) != len(expected) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected %v tokens. Got %v", len(expected), len(tokens))
+			continue
+		}
+		for i, tk := range tokens {
+			if tk.String() != expected[i] {
+				t.Errorf("[CASE] %v", c.desc)
+				t.Errorf("Expected: %q, Actual: %q", expected[i], tk.String())
+			}
+		}
+	}
+
+	// Absent fields have the default values.
+	tokens, err := ParseFreeOTP([]byte(`{"tokens":[{"label":"carol","secret":[49,50,51,52,53,54,55,56,57,48]}]}`))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].String() != "otpauth://totp/carol?secret=GEZDGNBVGY3TQOJQ&algorithm=SHA1&digits=6&period=30" {
+		t.Errorf("Unexpected tokens: %v", tokens)
+	}
+}
+
+func TestParseFreeOTPErrors(t *testing.T) {
+	cases := []struct {
+		desc string
+		data string
+		err  error
+	}{
+		{
+			desc: "Malformed JSON should be rejected",
+			data: `{"tokens":[`,
+			err:  ErrInvalidBackup,
+		},
+		{
+			desc: "Malformed array should be rejected",
+			data: `[{"label":1}]`,
+			err:  ErrInvalidBackup,
+		},
+		{
+			desc: "Token without secret should be rejected",
+			data: `{"tokens":[{"label":"alice"}]}`,
+			err:  ErrMissingSecret,
+		},
+		{
+			desc: "Empty secret should be rejected",
+			data: `{"tokens":[{"label":"alice","secret":[]}]}`,
+			err:  ErrMissingSecret,
+		},
+		{
+			desc: "Secret out of the range of bytes should be rejected",
+			data: `{"tokens":[{"label":"alice","secret":[72,256]}]}`,
+			err:  ErrInvalidSecret,
+		},
+		{
+			desc: "Secret not in Base32 should be rejected",
+			data: `{"tokens":[{"label":"alice","secret":"01010101"}]}`,
+			err:  ErrInvalidSecret,
+		},
+		{
+			desc: "Unknown type should be rejected",
+			data: `{"tokens":[{"label":"alice","secret":[72,101],"type":"MOTP"}]}`,
+			err:  ErrInvalidHost,
+		},
+		{
+			desc: "Unknown algorithm should be rejected",
+			data: `{"tokens":[{"label":"alice","secret":[72,101],"algo":"MD5"}]}`,
+			err:  ErrInvalidAlgorithm,
+		},
+		{
+			desc: "Digits out of range should be rejected",
+			data: `{"tokens":[{"label":"alice","secret":[72,101],"digits":4}]}`,
+			err:  ErrDigitsOutOfRange,
+		},
+	}
+	for _, c := range cases {
+		_, err := ParseFreeOTP([]byte(c.data))
+		if !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+		}
+	}
+}
@@ -1,3 +1,10 @@
 module github.com/tmsick/totp
 
 go 1.18
+
+require (
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/crypto v0.21.0
+)
+
+require golang.org/x/sys v0.18.0 // indirect
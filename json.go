@@ -0,0 +1,107 @@
+package totp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// tokenJSON is the JSON representation of a Token.
+type tokenJSON struct {
+	Type      string     `json:"type"`
+	Label     string     `json:"label"`
+	Issuer    string     `json:"issuer"`
+	Algorithm string     `json:"algorithm"`
+	Digits    int        `json:"digits"`
+	Period    int        `json:"period"`
+	Counter   uint64     `json:"counter,omitempty"`
+	Epoch     int64      `json:"epoch,omitempty"`
+	Image     string     `json:"image,omitempty"`
+	Alphabet  string     `json:"alphabet,omitempty"`
+	Length    int        `json:"length,omitempty"`
+	Params    url.Values `json:"params,omitempty"`
+	Secret    string     `json:"secret"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+// The secret is encoded as an uppercase Base32 string without padding as it appears in a Key URI. Query parameters
+// NewToken didn't recognize are kept in "params" so that they aren't lost.
+func (t *Token) MarshalJSON() ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return json.Marshal(tokenJSON{
+		Type:      t.typ,
+		Label:     t.label,
+		Issuer:    t.issuer,
+		Algorithm: t.algorithm.name,
+		Digits:    t.digits,
+		Period:    t.period,
+		Counter:   t.counter,
+		Epoch:     t.epoch,
+		Image:     t.image,
+		Alphabet:  t.alphabet,
+		Length:    t.length,
+		Params:    t.extraParams,
+		Secret:    encodeSecret(t.secret),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+// The same validation rules and default values as NewToken are applied to the fields.
+func (t *Token) UnmarshalJSON(data []byte) error {
+	v := tokenJSON{
+		Type:      typeTOTP,
+		Algorithm: algorithmDefault.name,
+		Digits:    digitsDefault,
+		Period:    periodDefault,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	if v.Type != typeTOTP && v.Type != typeHOTP {
+		return fmt.Errorf("Type have to be \"totp\" or \"hotp\". Got %q", v.Type)
+	}
+	secret, err := decodeSecret(v.Secret)
+	if err != nil {
+		return err
+	}
+	opts := []Option{
+		WithLabel(v.Label),
+		WithIssuer(v.Issuer),
+		WithAlgorithm(v.Algorithm),
+		// The digits and the period might have been allowed by WithMaxDigits and WithMaxPeriod when the token was built.
+		WithMaxDigits(digitsLimit),
+		WithDigits(v.Digits),
+		WithMaxPeriod(periodLimit),
+		WithPeriod(v.Period),
+		WithEpoch(time.Unix(v.Epoch, 0)),
+	}
+	if v.Image != "" {
+		opts = append(opts, WithImage(v.Image))
+	}
+	if v.Alphabet != "" {
+		opts = append(opts, WithAlphabet(v.Alphabet, v.Length))
+	}
+	tk, err := NewTokenFromParams(secret, opts...)
+	if err != nil {
+		return err
+	}
+	tk.typ = v.Type
+	tk.counter = v.Counter
+	for name, values := range v.Params {
+		// Known parameters would be emitted twice by String.
+		if knownParams[name] {
+			return fmt.Errorf("Params have to hold unknown parameters only. Got %q", name)
+		}
+		if tk.extraParams == nil {
+			tk.extraParams = url.Values{}
+		}
+		tk.extraParams[name] = append([]string(nil), values...)
+	}
+	tk.fitBounds()
+
+	t.assign(tk)
+	return nil
+}
@@ -0,0 +1,147 @@
+package totp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	uris := []string{
+		"otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice&algorithm=SHA512&digits=8&period=60",
+		"otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=42",
+		"otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&image=https%3A%2F%2Fexample.com%2Flogo.png",
+		"otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&color=blue&tag=a&tag=b",
+	}
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+
+	for _, uri := range uris {
+		tk, err := NewToken(uri)
+		if err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+
+		data, err := json.Marshal(tk)
+		if err != nil {
+			t.Errorf("Failed to marshal token for %q: %v", uri, err)
+			continue
+		}
+
+		var rt Token
+		if err := json.Unmarshal(data, &rt); err != nil {
+			t.Errorf("Failed to unmarshal token for %q: %v", uri, err)
+			continue
+		}
+
+		if rt.String() != tk.String() {
+			t.Errorf("Round-tripped token differs. Expected: %q, Actual: %q", tk.String(), rt.String())
+		}
+		if rt.Generate(tm) != tk.Generate(tm) {
+			t.Errorf("Round-tripped token generated a different OTP for %q", uri)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	cases := []struct {
+		desc string
+		data string
+		ok   bool
+	}{
+		{
+			desc: "Only \"secret\" should be accepted",
+			data: `{"secret":"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}`,
+			ok:   true,
+		},
+		{
+			desc: "Missing \"secret\" should be rejected",
+			data: `{"label":"exampleservice:exampleuser"}`,
+			ok:   false,
+		},
+		{
+			desc: "Invalid \"secret\" should be rejected",
+			data: `{"secret":"01010101010101010101010101010101"}`,
+			ok:   false,
+		},
+		{
+			desc: "Invalid \"type\" should be rejected",
+			data: `{"type":"motp","secret":"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}`,
+			ok:   false,
+		},
+		{
+			desc: "Invalid \"algorithm\" should be rejected",
+			data: `{"algorithm":"MD5","secret":"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}`,
+			ok:   false,
+		},
+		{
+			desc: "\"digits\" allowed by WithMaxDigits should be accepted",
+			data: `{"digits":12,"secret":"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}`,
+			ok:   true,
+		},
+		{
+			desc: "Invalid \"digits\" should be rejected",
+			data: `{"digits":19,"secret":"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}`,
+			ok:   false,
+		},
+		{
+			desc: "Invalid \"period\" should be rejected",
+			data: `{"period":0,"secret":"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}`,
+			ok:   false,
+		},
+		{
+			desc: "Huge \"length\" should be rejected",
+			data: `{"secret":"GEZDGNBVGY3TQOJQ","alphabet":"ab","length":4611686018427387904}`,
+			ok:   false,
+		},
+		{
+			desc: "Unknown parameters in \"params\" should be accepted",
+			data: `{"secret":"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ","params":{"color":["blue"]}}`,
+			ok:   true,
+		},
+		{
+			desc: "Known parameter in \"params\" should be rejected",
+			data: `{"secret":"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ","params":{"secret":["JBSWY3DPEHPK3PXP"]}}`,
+			ok:   false,
+		},
+		{
+			desc: "Malformed JSON should be rejected",
+			data: `{"secret":`,
+			ok:   false,
+		},
+	}
+	for _, c := range cases {
+		var tk Token
+		err := json.Unmarshal([]byte(c.data), &tk)
+		if c.ok && err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Error("Expected an error but didn't get one")
+		}
+	}
+}
+
+func TestJSONEpochRoundTrip(t *testing.T) {
+	tk, err := NewTokenFromParams([]byte("12345678901234567890"), WithEpoch(time.Unix(1000000015, 0)))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	data, err := json.Marshal(tk)
+	if err != nil {
+		t.Fatalf("Failed to marshal token: %v", err)
+	}
+	var rt Token
+	if err := json.Unmarshal(data, &rt); err != nil {
+		t.Fatalf("Failed to unmarshal token: %v", err)
+	}
+	if !rt.Equal(tk) {
+		t.Errorf("Round-tripped token differs. JSON: %s", data)
+	}
+}
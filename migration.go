@@ -0,0 +1,300 @@
+package totp
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"net/url"
+	"strings"
+)
+
+// Enum values of the MigrationPayload protobuf message Google Authenticator exports.
+const (
+	migrationAlgorithmUnspecified = 0
+	migrationAlgorithmSHA1        = 1
+	migrationAlgorithmSHA256      = 2
+	migrationAlgorithmSHA512      = 3
+	migrationAlgorithmMD5         = 4
+
+	migrationDigitsUnspecified = 0
+	migrationDigitsSix         = 1
+	migrationDigitsEight       = 2
+
+	migrationTypeUnspecified = 0
+	migrationTypeHOTP        = 1
+	migrationTypeTOTP        = 2
+)
+
+// Protobuf wire types used by MigrationPayload.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// ParseMigration returns the tokens exported by Google Authenticator as an "otpauth-migration://offline?data=..."
+// URI. `data` is a Base64-encoded MigrationPayload protobuf message, each of whose entries becomes a Token.
+//
+// Google Authenticator doesn't export the period, so TOTP tokens have the default period of 30 seconds.
+func ParseMigration(uri string) ([]*Token, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, errorf(ErrInvalidURI, "Failed to parse migration URI")
+	}
+	if u.Scheme != "otpauth-migration" {
+		return nil, errorf(ErrInvalidScheme, "Scheme have to be \"otpauth-migration\". Got %q", u.Scheme)
+	}
+	if u.Host != "offline" {
+		return nil, errorf(ErrInvalidHost, "Host have to be \"offline\". Got %q", u.Host)
+	}
+	if !u.Query().Has("data") {
+		return nil, errorf(ErrInvalidMigration, "Data is required in query parameter")
+	}
+
+	// "+" in the Base64 data is decoded as a space when it isn't percent-encoded.
+	rawData := strings.ReplaceAll(u.Query().Get("data"), " ", "+")
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(rawData, "="))
+	if err != nil {
+		return nil, errorf(ErrInvalidMigration, "Data cannot be decoded as Base64")
+	}
+
+	var tokens []*Token
+	err = parseProto(data, func(field int, _ uint64, b []byte) error {
+		if field != 1 || b == nil {
+			// Version and batch information are irrelevant.
+			return nil
+		}
+		t, err := parseMigrationEntry(b)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// parseMigrationEntry returns a Token from an OtpParameters protobuf message.
+func parseMigrationEntry(data []byte) (*Token, error) {
+	t := &Token{
+		typ:       typeTOTP,
+		algorithm: algorithmDefault,
+		digits:    digitsDefault,
+		period:    periodDefault,
+	}
+	var counter int64
+	err := parseProto(data, func(field int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			t.secret = append([]byte{}, b...)
+		case 2:
+			t.label = string(b)
+		case 3:
+			t.issuer = string(b)
+		case 4:
+			switch v {
+			case migrationAlgorithmUnspecified, migrationAlgorithmSHA1:
+				t.algorithm = algorithmSHA1
+			case migrationAlgorithmSHA256:
+				t.algorithm = algorithmSHA256
+			case migrationAlgorithmSHA512:
+				t.algorithm = algorithmSHA512
+			case migrationAlgorithmMD5:
+				return errorf(ErrInvalidAlgorithm, "Algorithm MD5 is not supported")
+			default:
+				return errorf(ErrInvalidAlgorithm, "Unknown algorithm %v", v)
+			}
+		case 5:
+			switch v {
+			case migrationDigitsUnspecified, migrationDigitsSix:
+				t.digits = 6
+			case migrationDigitsEight:
+				t.digits = 8
+			default:
+				return errorf(ErrInvalidDigits, "Unknown digit count %v", v)
+			}
+		case 6:
+			switch v {
+			case migrationTypeUnspecified, migrationTypeTOTP:
+				t.typ = typeTOTP
+			case migrationTypeHOTP:
+				t.typ = typeHOTP
+			default:
+				return errorf(ErrInvalidMigration, "Unknown OTP type %v", v)
+			}
+		case 7:
+			counter = int64(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(t.secret) == 0 {
+		return nil, errorf(ErrMissingSecret, "Secret is required in OTP parameters of %q", t.label)
+	}
+	if counter < 0 {
+		return nil, errorf(ErrInvalidCounter, "Counter have to be non-negative. Got %v", counter)
+	}
+	if t.typ == typeHOTP {
+		t.counter = uint64(counter)
+	}
+	if labelIssuer, _ := splitLabel(t.label); t.issuer == "" {
+		t.issuer = labelIssuer
+	}
+	return t, nil
+}
+
+// ExportMigration returns an "otpauth-migration://offline?data=..." URI bundling `tokens`, which Google Authenticator
+// imports at once. It is the inverse of ParseMigration.
+//
+// The payload can only express what Google Authenticator supports, so ExportMigration returns an error for tokens with
+// an algorithm other than "SHA1", "SHA256", and "SHA512", digits other than 6 and 8, a period other than 30, a custom
+// alphabet or epoch, or a counter beyond the range of a signed 64-bit integer.
+func ExportMigration(tokens []*Token) (string, error) {
+	var payload []byte
+	for i, t := range tokens {
+		if t == nil {
+			return "", errorf(ErrInvalidMigration, "Token at index %v is nil", i)
+		}
+		t.mu.RLock()
+		entry, err := migrationEntry(t)
+		t.mu.RUnlock()
+		if err != nil {
+			return "", err
+		}
+		payload = appendProtoBytes(payload, 1, entry)
+	}
+	payload = appendProtoVarint(payload, 2, 1) // version
+	payload = appendProtoVarint(payload, 3, 1) // batch_size
+
+	return "otpauth-migration://offline?data=" + url.QueryEscape(base64.StdEncoding.EncodeToString(payload)), nil
+}
+
+// migrationEntry returns an OtpParameters protobuf message representing `t`.
+func migrationEntry(t *Token) ([]byte, error) {
+	if len(t.secret) == 0 {
+		return nil, errorf(ErrMissingSecret, "Secret of %q is empty", t.label)
+	}
+	if t.alphabet != "" {
+		return nil, errorf(ErrInvalidMigration, "Token %q with a custom alphabet cannot be exported", t.label)
+	}
+
+	var algorithm uint64
+	switch t.algorithm.name {
+	case algorithmSHA1.name:
+		algorithm = migrationAlgorithmSHA1
+	case algorithmSHA256.name:
+		algorithm = migrationAlgorithmSHA256
+	case algorithmSHA512.name:
+		algorithm = migrationAlgorithmSHA512
+	default:
+		return nil, errorf(ErrInvalidAlgorithm, "Algorithm have to be \"SHA1\", \"SHA256\", or \"SHA512\" to be exported. Got %q", t.algorithm.name)
+	}
+
+	var digits uint64
+	switch t.digits {
+	case 6:
+		digits = migrationDigitsSix
+	case 8:
+		digits = migrationDigitsEight
+	default:
+		return nil, errorf(ErrInvalidDigits, "Digits have to be 6 or 8 to be exported. Got %v", t.digits)
+	}
+
+	var entry []byte
+	entry = appendProtoBytes(entry, 1, t.secret)
+	entry = appendProtoBytes(entry, 2, []byte(t.label))
+	if t.issuer != "" {
+		entry = appendProtoBytes(entry, 3, []byte(t.issuer))
+	}
+	entry = appendProtoVarint(entry, 4, algorithm)
+	entry = appendProtoVarint(entry, 5, digits)
+	if t.typ == typeHOTP {
+		if t.counter > math.MaxInt64 {
+			return nil, errorf(ErrInvalidCounter, "Counter have to be at most %v to be exported. Got %v", int64(math.MaxInt64), t.counter)
+		}
+		entry = appendProtoVarint(entry, 6, migrationTypeHOTP)
+		entry = appendProtoVarint(entry, 7, t.counter)
+	} else {
+		if t.period != periodDefault {
+			return nil, errorf(ErrInvalidPeriod, "Period have to be %v to be exported. Got %v", periodDefault, t.period)
+		}
+		if t.epoch != 0 {
+			return nil, errorf(ErrInvalidMigration, "Token %q with a custom epoch cannot be exported", t.label)
+		}
+		entry = appendProtoVarint(entry, 6, migrationTypeTOTP)
+	}
+	return entry, nil
+}
+
+// appendProtoVarint appends a varint field to a protobuf message.
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	b = appendUvarint(b, uint64(field)<<3|wireVarint)
+	return appendUvarint(b, v)
+}
+
+// appendProtoBytes appends a length-delimited field to a protobuf message.
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = appendUvarint(b, uint64(field)<<3|wireBytes)
+	b = appendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// parseProto calls `fn` for each field of a protobuf message in `data`. `v` holds the value of a varint field, and `b`
+// holds the value of a length-delimited field. Fixed-size fields are skipped.
+func parseProto(data []byte, fn func(field int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errorf(ErrInvalidMigration, "Malformed field key")
+		}
+		data = data[n:]
+		field, wire := int(key>>3), int(key&7)
+
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return errorf(ErrInvalidMigration, "Malformed varint in field %v", field)
+			}
+			data = data[n:]
+			if err := fn(field, v, nil); err != nil {
+				return err
+			}
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || l > uint64(len(data)-n) {
+				return errorf(ErrInvalidMigration, "Malformed length in field %v", field)
+			}
+			b := data[n : n+int(l)]
+			data = data[n+int(l):]
+			if err := fn(field, 0, b); err != nil {
+				return err
+			}
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wire == wireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return errorf(ErrInvalidMigration, "Truncated field %v", field)
+			}
+			data = data[size:]
+		default:
+			return errorf(ErrInvalidMigration, "Unsupported wire type %v in field %v", wire, field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package totp
+
+import (
+	"errors"
+	"testing"
+)
+
+// migrationURI holds a TOTP entry "Example:alice@google.com" and an HOTP entry "bob@example.com" whose secrets are
+// "12345678901234567890".
+const migrationURI = "otpauth-migration://offline?data=Cj8KFDEyMzQ1Njc4OTAxMjM0NTY3ODkwEhhFeGFtcGxlOmFsaWNlQGdvb2dsZS5jb20aB0V4YW1wbGUgASgBMAIKMQoUMTIzNDU2Nzg5MDEyMzQ1Njc4OTASD2JvYkBleGFtcGxlLmNvbRoAIAIoAjABOAUQARgBIAAoAA%3D%3D"
+
+func TestParseMigration(t *testing.T) {
+	tokens, err := ParseMigration(migrationURI)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	expected := []string{
+		"otpauth://totp/Example:alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Example&algorithm=SHA1&digits=6&period=30",
+		"otpauth://hotp/bob@example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=SHA256&digits=8&counter=5",
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %v tokens. Got %v", len(expected), len(tokens))
+	}
+	for i, tk := range tokens {
+		if tk.String() != expected[i] {
+			t.Errorf("Expected: %q, Actual: %q", expected[i], tk.String())
+		}
+	}
+}
+
+func TestParseMigrationErrors(t *testing.T) {
+	cases := []struct {
+		desc string
+		uri  string
+		err  error
+	}{
+		{
+			desc: "Invalid scheme should be rejected",
+			uri:  "otpauth://offline?data=Cj8K",
+			err:  ErrInvalidScheme,
+		},
+		{
+			desc: "Invalid host should be rejected",
+			uri:  "otpauth-migration://online?data=Cj8K",
+			err:  ErrInvalidHost,
+		},
+		{
+			desc: "Missing data should be rejected",
+			uri:  "otpauth-migration://offline",
+			err:  ErrInvalidMigration,
+		},
+		{
+			desc: "Data not in Base64 should be rejected",
+			uri:  "otpauth-migration://offline?data=%21%21%21",
+			err:  ErrInvalidMigration,
+		},
+		{
+			desc: "Truncated payload should be rejected",
+			uri:  "otpauth-migration://offline?data=Cj8K",
+			err:  ErrInvalidMigration,
+		},
+		{
+			desc: "Entry without secret should be rejected",
+			uri:  "otpauth-migration://offline?data=CgUSA2JvYg",
+			err:  ErrMissingSecret,
+		},
+		{
+			desc: "MD5 should be rejected",
+			uri:  "otpauth-migration://offline?data=CggKBBI0VnggBA",
+			err:  ErrInvalidAlgorithm,
+		},
+	}
+	for _, c := range cases {
+		_, err := ParseMigration(c.uri)
+		if !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+		}
+	}
+}
+
+func TestExportMigration(t *testing.T) {
+	uris := []string{
+		"otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example",
+		"otpauth://totp/bob@example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=SHA512&digits=8",
+		"otpauth://hotp/carol@example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=42",
+	}
+	var tokens []*Token
+	for _, uri := range uris {
+		tk, err := NewToken(uri)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		tokens = append(tokens, tk)
+	}
+
+	uri, err := ExportMigration(tokens)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	imported, err := ParseMigration(uri)
+	if err != nil {
+		t.Fatalf("Failed to parse exported URI %q: %v", uri, err)
+	}
+	if len(imported) != len(tokens) {
+		t.Fatalf("Expected %v tokens. Got %v", len(tokens), len(imported))
+	}
+	for i, tk := range imported {
+		if tk.String() != tokens[i].String() {
+			t.Errorf("Expected: %q, Actual: %q", tokens[i].String(), tk.String())
+		}
+	}
+}
+
+func TestExportMigrationErrors(t *testing.T) {
+	cases := []struct {
+		desc string
+		uri  string
+		err  error
+	}{
+		{
+			desc: "SHA3-256 cannot be exported",
+			uri:  "otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&algorithm=SHA3-256",
+			err:  ErrInvalidAlgorithm,
+		},
+		{
+			desc: "7 digits cannot be exported",
+			uri:  "otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&digits=7",
+			err:  ErrInvalidDigits,
+		},
+		{
+			desc: "Period other than 30 cannot be exported",
+			uri:  "otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&period=60",
+			err:  ErrInvalidPeriod,
+		},
+		{
+			desc: "Counter beyond int64 cannot be exported",
+			uri:  "otpauth://hotp/alice@google.com?secret=JBSWY3DPEHPK3PXP&counter=9223372036854775808",
+			err:  ErrInvalidCounter,
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		_, err = ExportMigration([]*Token{tk})
+		if !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+		}
+	}
+
+	if _, err := ExportMigration([]*Token{nil}); !errors.Is(err, ErrInvalidMigration) {
+		t.Errorf("Expected: %v, Actual: %v", ErrInvalidMigration, err)
+	}
+}
@@ -0,0 +1,364 @@
+package totp
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// An Option configures a Token built by NewToken, NewTokenFromParams, and so on.
+type Option func(*options) error
+
+// options holds the parameters a Token is built from.
+type options struct {
+	label     string
+	issuer    string
+	algorithm algorithm
+	digits    int
+	period    int
+	epoch     int64
+	image     string
+	alphabet  string
+	length    int
+
+	lenientIssuer bool
+	lenientHost   bool
+	strictParams  bool
+	base64Secrets bool
+	minDigits     int
+	maxDigits     int
+	maxPeriod     int
+	minSecretBits int
+	secretBits    int
+	paddedBits    int
+	rand          io.Reader
+}
+
+func newOptions() *options {
+	return &options{
+		algorithm:  algorithmDefault,
+		digits:     digitsDefault,
+		period:     periodDefault,
+		minDigits:  DigitsMin,
+		maxDigits:  DigitsMax,
+		maxPeriod:  PeriodMax,
+		secretBits: secretBitsDefault,
+		rand:       rand.Reader,
+	}
+}
+
+// applyOptions returns options with `opts` applied in order.
+func applyOptions(opts []Option) (*options, error) {
+	o := newOptions()
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	// Options might depend on each other, e.g. WithDigits and WithMaxDigits, so they are checked again here.
+	if o.minDigits > o.maxDigits {
+		return nil, fmt.Errorf("Min digits have to be less than or equal to max digits %v. Got %v", o.maxDigits, o.minDigits)
+	}
+	if o.digits > o.maxDigits {
+		return nil, errorf(ErrDigitsOutOfRange, "Digits have to be in the range of [%v, %v]. Got %v", o.minDigits, o.maxDigits, o.digits)
+	}
+	if o.period > o.maxPeriod {
+		return nil, errorf(ErrPeriodOutOfRange, "Period have to be in the range of [%v, %v]. Got %v", PeriodMin, o.maxPeriod, o.period)
+	}
+	return o, nil
+}
+
+// WithLabel sets the label of the token, e.g. "Example:alice@google.com".
+func WithLabel(label string) Option {
+	return func(o *options) error {
+		o.label = label
+		return nil
+	}
+}
+
+// WithIssuer sets the issuer of the token, e.g. "Example".
+func WithIssuer(issuer string) Option {
+	return func(o *options) error {
+		o.issuer = issuer
+		return nil
+	}
+}
+
+// WithImage sets the URL of the issuer's logo, which some authenticator apps display next to the token.
+// `image` has to be an absolute URL such as "https://example.com/logo.png".
+func WithImage(image string) Option {
+	return func(o *options) error {
+		if err := checkImage(image); err != nil {
+			return err
+		}
+		o.image = image
+		return nil
+	}
+}
+
+// checkImage checks that `image` is an absolute URL.
+func checkImage(image string) error {
+	u, err := url.Parse(image)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errorf(ErrInvalidImage, "Image have to be an absolute URL. Got %q", image)
+	}
+	return nil
+}
+
+// WithAlgorithm sets the hash function used to generate TOTPs.
+// `name` has to be one of "SHA1", "SHA256", "SHA512", "SHA3-256", "SHA3-512", or the name of an algorithm registered
+// with RegisterAlgorithm, which is matched case-insensitively. The default is "SHA1".
+func WithAlgorithm(name string) Option {
+	return func(o *options) error {
+		algorithm, ok := lookupAlgorithm(name)
+		if !ok {
+			return algorithmError(name)
+		}
+		o.algorithm = algorithm
+		return nil
+	}
+}
+
+// WithDigits sets the number of digits OTPs have.
+// `digits` has to be in the range of [6, 10] unless the upper bound is changed by WithMaxDigits. The default is 6.
+func WithDigits(digits int) Option {
+	return func(o *options) error {
+		if digits < DigitsMin || digits > digitsLimit {
+			return errorf(ErrDigitsOutOfRange, "Digits have to be in the range of [%v, %v]. Got %v", DigitsMin, o.maxDigits, digits)
+		}
+		o.digits = digits
+		return nil
+	}
+}
+
+// WithMaxDigits changes the upper bound of digits accepted by NewToken and WithDigits from the default 10 to `max`,
+// which has to be in the range of [6, 18].
+//
+// Note that OTPs are derived from a 31-bit integer, which has at most 10 decimal digits. OTPs with more than 10 digits
+// are merely zero-padded and don't get any stronger.
+func WithMaxDigits(max int) Option {
+	return func(o *options) error {
+		if max < DigitsMin || max > digitsLimit {
+			return fmt.Errorf("Max digits have to be in the range of [%v, %v]. Got %v", DigitsMin, digitsLimit, max)
+		}
+		o.maxDigits = max
+		return nil
+	}
+}
+
+// WithMinDigits changes the lower bound of digits accepted by constructors from the default 6 to `min`, which has to be
+// in the range of [6, 18], e.g. to enforce a security policy requiring at least 8 digits on import. Unlike the upper
+// bound, it also applies to the default number of digits, so NewToken rejects a Key URI without `digits` when `min`
+// is greater than 6 unless WithDigits gives another default.
+func WithMinDigits(min int) Option {
+	return func(o *options) error {
+		if min < DigitsMin || min > digitsLimit {
+			return fmt.Errorf("Min digits have to be in the range of [%v, %v]. Got %v", DigitsMin, digitsLimit, min)
+		}
+		o.minDigits = min
+		return nil
+	}
+}
+
+// WithPeriod sets the time duration in seconds a TOTP lives.
+// `period` has to be in the range of [1, 90] unless the upper bound is changed by WithMaxPeriod. The default is 30.
+func WithPeriod(period int) Option {
+	return func(o *options) error {
+		if period < PeriodMin || period > periodLimit {
+			return errorf(ErrPeriodOutOfRange, "Period have to be in the range of [%v, %v]. Got %v", PeriodMin, o.maxPeriod, period)
+		}
+		o.period = period
+		return nil
+	}
+}
+
+// WithMaxPeriod raises the upper bound of the period accepted by NewToken and WithPeriod from the default 90 to `max`,
+// e.g. for enterprise tokens with a period of 120 or 300 seconds. `max` has to be at least 90 and fit in a 32-bit
+// signed integer. RFC 6238 doesn't bound the period, but 90 is kept as the default because most authenticator apps
+// don't support longer ones.
+func WithMaxPeriod(max int) Option {
+	return func(o *options) error {
+		if max < PeriodMax || max > periodLimit {
+			return fmt.Errorf("Max period have to be in the range of [%v, %v]. Got %v", PeriodMax, periodLimit, max)
+		}
+		o.maxPeriod = max
+		return nil
+	}
+}
+
+// WithPeriodDuration works like WithPeriod but takes a time.Duration.
+// `d` has to be a whole number of seconds in the range of [1s, 90s] unless the upper bound is changed by WithMaxPeriod.
+func WithPeriodDuration(d time.Duration) Option {
+	return func(o *options) error {
+		if d%time.Second != 0 {
+			return errorf(ErrInvalidPeriod, "Period have to be a whole number of seconds. Got %v", d)
+		}
+		return WithPeriod(int(d / time.Second))(o)
+	}
+}
+
+// WithEpoch sets the time TOTP counters start from, which is T0 in RFC 6238. It has to be a whole second. The default
+// is the Unix epoch, and only some legacy systems use another one. T0 isn't part of the Key URI format, so String
+// doesn't represent it.
+func WithEpoch(epoch time.Time) Option {
+	return func(o *options) error {
+		if epoch.Nanosecond() != 0 {
+			return fmt.Errorf("Epoch have to be a whole second. Got %v", epoch)
+		}
+		o.epoch = epoch.Unix()
+		return nil
+	}
+}
+
+// WithLenientIssuer makes NewToken accept a Key URI whose `issuer` query parameter differs from the issuer prefix of
+// the label. The query parameter takes precedence in that case.
+func WithLenientIssuer() Option {
+	return func(o *options) error {
+		o.lenientIssuer = true
+		return nil
+	}
+}
+
+// WithLenientHost makes NewToken accept a Key URI without a host whose type is the first path element instead, like
+// "otpauth:///totp/alice@google.com?secret=..." or "otpauth:/hotp/alice@google.com?secret=...", as some exporters emit.
+// Such URIs deviate from the Key URI format, so they are rejected by default. String always emits the standard form.
+func WithLenientHost() Option {
+	return func(o *options) error {
+		o.lenientHost = true
+		return nil
+	}
+}
+
+// WithStrictParams makes NewToken reject a Key URI with query parameters other than the ones defined in the Key URI
+// format, or with any of the defined ones appearing more than once. By default, unknown parameters are kept in the
+// token and emitted again by String, and only the first of duplicated parameters is used.
+func WithStrictParams() Option {
+	return func(o *options) error {
+		o.strictParams = true
+		return nil
+	}
+}
+
+// WithBase64Secrets makes NewToken accept secrets encoded as URL-safe Base64 instead of Base32, as some non-standard
+// issuers do. Such a secret is decoded as Base64 when the `encoding` query parameter is "base64", or when it cannot be
+// decoded as Base32. String still emits the secret in Base32.
+//
+// It is off by default because a string can be valid in both encodings, so a standard Key URI might be misinterpreted.
+func WithBase64Secrets() Option {
+	return func(o *options) error {
+		o.base64Secrets = true
+		return nil
+	}
+}
+
+// WithAlphabet makes the token render OTPs as `length` characters from `alphabet` instead of decimal digits, as some
+// services like Steam Guard do. The truncated HMAC value is written in base `len(alphabet)`, starting from the least
+// significant position. The token's digits are not used in that case.
+//
+// `alphabet` has to consist of at least 2 distinct characters without duplicates and `length` has to be in the range
+// of [1, 31], as the truncated HMAC value has no more than 31 characters in any base.
+// The alphabet isn't part of the Key URI format, so String doesn't represent it.
+func WithAlphabet(alphabet string, length int) Option {
+	return func(o *options) error {
+		seen := map[rune]bool{}
+		for _, c := range alphabet {
+			if seen[c] {
+				return fmt.Errorf("Alphabet have to consist of distinct characters. Got %q", alphabet)
+			}
+			seen[c] = true
+		}
+		if len(seen) < 2 {
+			return fmt.Errorf("Alphabet have to consist of at least 2 characters. Got %q", alphabet)
+		}
+		if length <= 0 || length > alphabetLengthMax {
+			return fmt.Errorf("Length have to be in the range of [1, %v]. Got %v", alphabetLengthMax, length)
+		}
+		o.alphabet = alphabet
+		o.length = length
+		return nil
+	}
+}
+
+// WithMinSecretBits makes constructors reject secrets shorter than `bits` bits. There's no minimum by default.
+// RFC 4226 requires at least 128 bits and recommends 160 bits.
+func WithMinSecretBits(bits int) Option {
+	return func(o *options) error {
+		if bits < 0 {
+			return fmt.Errorf("Min secret bits have to be non-negative. Got %v", bits)
+		}
+		o.minSecretBits = bits
+		return nil
+	}
+}
+
+// WithSecretBits sets the length in bits of the random secret NewRandomToken generates. `bits` has to be a multiple of
+// 8 and at least 128 as RFC 4226 requires. The default is 160. Other constructors ignore it.
+func WithSecretBits(bits int) Option {
+	return func(o *options) error {
+		if err := checkSecretBits(bits); err != nil {
+			return err
+		}
+		o.secretBits = bits
+		return nil
+	}
+}
+
+// WithRandSource sets the source of randomness NewRandomToken reads the secret from. The default is crypto/rand.Reader,
+// and `r` has to be cryptographically secure as well unless it's for tests, which can pass a fixed reader to get a
+// known secret. Other constructors ignore it.
+func WithRandSource(r io.Reader) Option {
+	return func(o *options) error {
+		if r == nil {
+			return fmt.Errorf("Random source is nil")
+		}
+		o.rand = r
+		return nil
+	}
+}
+
+// WithSecretNormalization makes constructors right-pad secrets shorter than `bits` bits with zero bytes, as some
+// legacy systems expect. `bits` has to be a multiple of 8 in the range of [0, 8192], i.e. up to the 1024 bytes
+// NewTokenFromSecretReader accepts. Secrets are used as-is by default.
+//
+// The padded secret is what SecretBytes and String return. As HMAC pads its key with zeros anyway, OTPs don't change
+// as long as `bits` doesn't exceed the block size of the hash function, e.g. 512 bits for SHA-1. The padding is applied
+// before the check of WithMinSecretBits.
+func WithSecretNormalization(bits int) Option {
+	return func(o *options) error {
+		if bits < 0 || bits > secretBytesMax*8 || bits%8 != 0 {
+			max := secretBytesMax * 8
+			return fmt.Errorf("Secret normalization bits have to be a multiple of 8 in the range of [0, %v]. Got %v", max, bits)
+		}
+		o.paddedBits = bits
+		return nil
+	}
+}
+
+// normalizeSecret returns `secret` right-padded with zero bytes up to the length set by WithSecretNormalization.
+// `secret` is returned as it is when it's long enough.
+func (o *options) normalizeSecret(secret []byte) []byte {
+	if len(secret)*8 >= o.paddedBits {
+		return secret
+	}
+	padded := make([]byte, o.paddedBits/8)
+	copy(padded, secret)
+	return padded
+}
+
+// checkDigits checks that `digits` is in the range set by WithMinDigits and WithMaxDigits.
+func (o *options) checkDigits(digits int) error {
+	if digits < o.minDigits || digits > o.maxDigits {
+		return errorf(ErrDigitsOutOfRange, "Digits have to be in the range of [%v, %v]. Got %v", o.minDigits, o.maxDigits, digits)
+	}
+	return nil
+}
+
+// checkSecret checks that `secret` satisfies the policy of the options.
+func (o *options) checkSecret(secret []byte) error {
+	if len(secret)*8 < o.minSecretBits {
+		return errorf(ErrSecretTooShort, "Secret have to be at least %v bits long. Got %v bits", o.minSecretBits, len(secret)*8)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Package qr renders the Key URI of a totp.Token as a QR code, which authenticator apps scan to enroll the token.
+//
+// It lives in its own package so that users of package totp who don't need QR codes aren't forced to depend on a QR
+// code encoder.
+package qr
+
+import (
+	"fmt"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/tmsick/totp"
+)
+
+// PNG returns a PNG image of a QR code encoding the Key URI of `t`.
+// `size` is the width and height of the image in pixels and has to be positive.
+func PNG(t *totp.Token, size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("Size have to be positive. Got %v", size)
+	}
+	return qrcode.Encode(t.String(), qrcode.Medium, size)
+}
+
+// Terminal returns a QR code encoding the Key URI of `t` drawn with block and half-block characters, which can be
+// printed to a terminal with fmt.Println and scanned directly from the screen.
+//
+// Dark modules are drawn as blank and light modules as blocks, which reads correctly on terminals with a dark
+// background. Use TerminalInverted for terminals with a light background.
+func Terminal(t *totp.Token) (string, error) {
+	return terminal(t, false)
+}
+
+// TerminalInverted works like Terminal but swaps dark and light, which reads correctly on terminals with a light
+// background.
+func TerminalInverted(t *totp.Token) (string, error) {
+	return terminal(t, true)
+}
+
+func terminal(t *totp.Token, inverted bool) (string, error) {
+	q, err := qrcode.New(t.String(), qrcode.Medium)
+	if err != nil {
+		return "", err
+	}
+	return q.ToSmallString(inverted), nil
+}
@@ -0,0 +1,86 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/tmsick/totp"
+)
+
+func TestPNG(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice"
+	tk, err := totp.NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	for _, size := range []int{128, 256, 512} {
+		data, err := PNG(tk, size)
+		if err != nil {
+			t.Errorf("Got unexpected error for size %v: %v", size, err)
+			continue
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("Failed to decode PNG for size %v: %v", size, err)
+			continue
+		}
+		if b := img.Bounds(); b.Dx() != size || b.Dy() != size {
+			t.Errorf("Image size didn't match. Expected: %vx%v, Actual: %vx%v", size, size, b.Dx(), b.Dy())
+		}
+	}
+
+	for _, size := range []int{0, -1} {
+		if _, err := PNG(tk, size); err == nil {
+			t.Errorf("Expected an error for size %v but didn't get one", size)
+		}
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice"
+	tk, err := totp.NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	normal, err := Terminal(tk)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	inverted, err := TerminalInverted(tk)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	normalLines := strings.Split(strings.TrimSuffix(normal, "\n"), "\n")
+	invertedLines := strings.Split(strings.TrimSuffix(inverted, "\n"), "\n")
+	if len(normalLines) != len(invertedLines) {
+		t.Fatalf("Line counts differ. Normal: %v, Inverted: %v", len(normalLines), len(invertedLines))
+	}
+
+	// Every cell of the inverted variant should be the complement of the normal one.
+	complement := map[rune]rune{' ': '█', '█': ' ', '▀': '▄', '▄': '▀'}
+	for i := range normalLines {
+		n := []rune(normalLines[i])
+		v := []rune(invertedLines[i])
+		if len(n) != len(v) {
+			t.Fatalf("Line #%v lengths differ. Normal: %v, Inverted: %v", i+1, len(n), len(v))
+		}
+		for j := range n {
+			c, ok := complement[n[j]]
+			if !ok {
+				t.Fatalf("Unexpected character %q at line #%v", n[j], i+1)
+			}
+			// The last line of a QR code with an odd number of rows has only upper halves.
+			if i == len(normalLines)-1 && (n[j] == ' ' || n[j] == '▀') && (v[j] == ' ' || v[j] == '▀') {
+				continue
+			}
+			if v[j] != c {
+				t.Fatalf("Inverted character at line #%v column #%v didn't match. Expected: %q, Actual: %q", i+1, j+1, c, v[j])
+			}
+		}
+	}
+}
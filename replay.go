@@ -0,0 +1,63 @@
+package totp
+
+import (
+	"sync"
+)
+
+// A ReplayStore records the last accepted time-step counter of each token for ReplayGuard. Implement it to share the
+// records among servers, e.g. with Redis.
+type ReplayStore interface {
+	// Advance records `counter` as the last accepted counter of the token identified by `key` and returns true if it's
+	// greater than the one recorded before or nothing has been recorded yet. Otherwise it returns false and keeps the
+	// record as it is. Checking and recording have to be done atomically.
+	Advance(key string, counter int64) (bool, error)
+}
+
+// ReplayGuard rejects OTPs that have already been accepted, which RFC 6238 requires of verifiers. Pass it a key
+// identifying the token, e.g. the ID of the user, and the counter VerifyAndGetCounter returns for an accepted code:
+//
+//	counter, ok := token.VerifyAndGetCounter(code, time.Now(), 1)
+//	if !ok || guard.Seen(userID, counter) {
+//		// Reject the code.
+//	}
+//
+// The key has to be stable across requests, since a token is usually loaded from storage anew for each of them.
+//
+// It is safe for concurrent use as long as its store is.
+type ReplayGuard struct {
+	store ReplayStore
+}
+
+// NewReplayGuard returns a ReplayGuard backed by `store`. When `store` is nil, the records are kept in memory, one per
+// key, and they are lost on restart.
+func NewReplayGuard(store ReplayStore) *ReplayGuard {
+	if store == nil {
+		store = &memoryReplayStore{counters: map[string]int64{}}
+	}
+	return &ReplayGuard{store: store}
+}
+
+// Seen reports whether an OTP of the token identified by `key` whose counter is `counter` or greater has already been
+// accepted, and records `counter` as accepted otherwise. A second submission of the same code, or of an older code, is
+// therefore reported as seen. It also reports true when the store returns an error so that codes are never accepted
+// twice.
+func (g *ReplayGuard) Seen(key string, counter int64) bool {
+	ok, err := g.store.Advance(key, counter)
+	return err != nil || !ok
+}
+
+// memoryReplayStore is a ReplayStore keeping the records in memory.
+type memoryReplayStore struct {
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+func (s *memoryReplayStore) Advance(key string, counter int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.counters[key]; ok && counter <= last {
+		return false, nil
+	}
+	s.counters[key] = counter
+	return true, nil
+}
@@ -0,0 +1,95 @@
+package totp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplayGuard(t *testing.T) {
+	guard := NewReplayGuard(nil)
+	cases := []struct {
+		desc     string
+		key      string
+		counter  int64
+		expected bool
+	}{
+		{"First code should be accepted", "alice", 100, false},
+		{"Same code should be rejected", "alice", 100, true},
+		{"Older code should be rejected", "alice", 99, true},
+		{"Newer code should be accepted", "alice", 101, false},
+		{"Code of another token should be accepted", "bob", 100, false},
+		{"Same code of another token should be rejected", "bob", 100, true},
+	}
+	for _, c := range cases {
+		if actual := guard.Seen(c.key, c.counter); actual != c.expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.expected, actual)
+		}
+	}
+}
+
+func TestReplayGuardWithVerify(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	code := tk.Generate(tm)
+	guard := NewReplayGuard(nil)
+
+	counter, ok := tk.VerifyAndGetCounter(code, tm, 1)
+	if !ok || guard.Seen("alice", counter) {
+		t.Errorf("First submission should be accepted")
+	}
+	// The same code is still valid within the skew, but it's a replay even if the token is loaded anew.
+	reloaded, err := NewToken(tk.String())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	counter, ok = reloaded.VerifyAndGetCounter(code, tm.Add(tk.PeriodDuration()), 1)
+	if !ok || !guard.Seen("alice", counter) {
+		t.Errorf("Second submission should be rejected")
+	}
+}
+
+func TestReplayGuardConcurrently(t *testing.T) {
+	guard := NewReplayGuard(nil)
+
+	// Exactly one of concurrent submissions of the same code is accepted.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !guard.Seen("alice", 100) {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("Expected: %v, Actual: %v", 1, accepted)
+	}
+}
+
+type failingReplayStore struct{}
+
+func (failingReplayStore) Advance(string, int64) (bool, error) {
+	return false, errors.New("Store is unavailable")
+}
+
+func TestReplayGuardWithFailingStore(t *testing.T) {
+	// Codes are rejected when the store doesn't work.
+	if !NewReplayGuard(failingReplayStore{}).Seen("alice", 100) {
+		t.Errorf("Code should be rejected when the store fails")
+	}
+}
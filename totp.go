@@ -1,27 +1,61 @@
 package totp
 
 import (
+	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"hash"
+	"io"
 	"math"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	typeTOTP = "totp"
+	typeHOTP = "hotp"
+)
+
+// Bounds of the digits and the period NewToken accepts, which are handy to validate user input in the same way.
+// The bounds of digits can be changed by WithMinDigits and WithMaxDigits, and the upper bound of the period by
+// WithMaxPeriod.
+const (
+	DigitsMin = 6
+	DigitsMax = 10
+	PeriodMin = 1
+	PeriodMax = 90
 )
 
 const (
 	digitsDefault = 6
-	digitsMax     = 10
-	digitsMin     = 6
+	digitsLimit   = 18 // The largest power of ten an int64 can hold is 10^18.
 	periodDefault = 30
-	periodMax     = 90
-	periodMin     = 1
+	periodLimit   = math.MaxInt32 // RFC 6238 has no upper bound, but this keeps the period in time.Duration.
+
+	secretBitsDefault = 160 // RFC 4226 recommends a secret of 160 bits.
+	secretBitsMin     = 128 // RFC 4226 requires a secret of at least 128 bits.
+	secretBytesMax    = 1024
+
+	generateRangeMax = 10000 // Bounds the memory GenerateRange allocates.
+
+	alphabetLengthMax = 31 // A 31-bit value has at most 31 characters in any base of 2 or more.
 )
 
 type algorithm struct {
@@ -30,196 +64,1684 @@ type algorithm struct {
 }
 
 // A Token represents a virtual TOTP token that generates a Time-Based One-Time Password defined in RFC 6238.
+// A Token parsed from an "otpauth://hotp/..." URI can also generate an HMAC-Based One-Time Password defined in
+// RFC 4226.
+//
+// A Token is safe for concurrent use by multiple goroutines. Setters such as SetPeriod can be called while other
+// goroutines generate or verify OTPs with the same token, and each call sees the parameters either before or after
+// the change, never a mixture of them.
 type Token struct {
+	// mu guards the fields below, which setters, Destroy, and unmarshaling might mutate.
+	mu sync.RWMutex
+
+	typ       string
 	label     string
 	secret    []byte
 	issuer    string
 	algorithm algorithm
 	digits    int
 	period    int
+	counter   uint64
+	epoch     int64 // T0 in RFC 6238 as a Unix time
+	image     string
+	clock     Clock
+
+	// extraParams holds the query parameters of the Key URI NewToken doesn't recognize. They are emitted again by
+	// String so that the Key URI round-trips. It is never modified once the token is built.
+	extraParams url.Values
+
+	// alphabet and length are set when OTPs are rendered in a custom alphabet instead of decimal digits.
+	alphabet string
+	length   int
+
+	// maxDigits and maxPeriod are the upper bounds the token was built with, which SetDigits and SetPeriod validate
+	// against.
+	maxDigits int
+	maxPeriod int
+
+	// macs caches HMAC states keyed with the secret so that generating an OTP doesn't set up a new one every time.
+	// The cached states are tagged with generation, which is bumped whenever the secret or the algorithm changes.
+	macs       sync.Pool
+	generation uint64
+}
+
+// A cachedMAC is an HMAC state cached in a Token.
+type cachedMAC struct {
+	hash       hash.Hash
+	generation uint64
+}
+
+// An Algorithm is the name of a hash function OTPs are generated with, as it appears in the `algorithm` parameter of
+// a Key URI. Besides the built-in ones below, algorithms registered with RegisterAlgorithm are also valid.
+type Algorithm string
+
+// Built-in algorithms.
+const (
+	AlgorithmSHA1    Algorithm = "SHA1"
+	AlgorithmSHA256  Algorithm = "SHA256"
+	AlgorithmSHA512  Algorithm = "SHA512"
+	AlgorithmSHA3256 Algorithm = "SHA3-256"
+	AlgorithmSHA3512 Algorithm = "SHA3-512"
+)
+
+// String returns the name of the algorithm, which can be passed to WithAlgorithm.
+func (a Algorithm) String() string {
+	return string(a)
+}
+
+// ParseAlgorithm returns the built-in or registered algorithm whose name is `name`. Names are matched
+// case-insensitively as in NewToken, and the result has the canonical casing, e.g. "sha256" results in
+// AlgorithmSHA256.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	a, ok := lookupAlgorithm(name)
+	if !ok {
+		return "", algorithmError(name)
+	}
+	return Algorithm(a.name), nil
 }
 
 var (
-	algorithmSHA1    algorithm = algorithm{"SHA1", sha1.New}
-	algorithmSHA256  algorithm = algorithm{"SHA256", sha256.New}
-	algorithmSHA512  algorithm = algorithm{"SHA512", sha512.New}
+	algorithmSHA1    algorithm = algorithm{string(AlgorithmSHA1), sha1.New}
+	algorithmSHA256  algorithm = algorithm{string(AlgorithmSHA256), sha256.New}
+	algorithmSHA512  algorithm = algorithm{string(AlgorithmSHA512), sha512.New}
+	algorithmSHA3256 algorithm = algorithm{string(AlgorithmSHA3256), sha3.New256}
+	algorithmSHA3512 algorithm = algorithm{string(AlgorithmSHA3512), sha3.New512}
 	algorithmDefault algorithm = algorithmSHA1
 )
 
+// algorithms holds the algorithms NewToken recognizes, keyed by their names.
+// Built-in algorithms come first in `algorithmNames` and custom ones follow in the order of registration.
+var (
+	algorithmsMu   sync.RWMutex
+	algorithms     = map[string]algorithm{}
+	algorithmNames []string
+)
+
+func init() {
+	for _, a := range []algorithm{algorithmSHA1, algorithmSHA256, algorithmSHA512, algorithmSHA3256, algorithmSHA3512} {
+		algorithms[a.name] = a
+		algorithmNames = append(algorithmNames, a.name)
+	}
+}
+
+// RegisterAlgorithm registers a custom hash function so that NewToken and WithAlgorithm recognize it by `name`.
+// Tokens with the algorithm generate OTPs with HMAC built on `fn`, whose output has to be at least 20 bytes long for
+// Dynamic Truncation.
+//
+// `name` must not collide with a built-in or already registered algorithm, ignoring case because names are matched
+// case-insensitively. RegisterAlgorithm is safe for concurrent use, but it is usually called during program
+// initialization.
+func RegisterAlgorithm(name string, fn func() hash.Hash) error {
+	if name == "" {
+		return fmt.Errorf("Algorithm name is empty")
+	}
+	if fn == nil {
+		return fmt.Errorf("Hash function for algorithm %q is nil", name)
+	}
+	if size := fn().Size(); size < macSizeMin {
+		return errorf(ErrInvalidAlgorithm, "Hash function for algorithm %q have to output at least %v bytes. Got %v bytes", name, macSizeMin, size)
+	}
+
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	if a, ok := lookupAlgorithmLocked(name); ok {
+		return fmt.Errorf("Algorithm %q is already registered as %q", name, a.name)
+	}
+	algorithms[name] = algorithm{name, fn}
+	algorithmNames = append(algorithmNames, name)
+	return nil
+}
+
+// lookupAlgorithm returns the algorithm whose name is `name`. Names are matched case-insensitively, e.g. "sha256"
+// results in "SHA256", as some issuers don't follow the casing of the spec.
+func lookupAlgorithm(name string) (algorithm, bool) {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	return lookupAlgorithmLocked(name)
+}
+
+// lookupAlgorithmLocked works like lookupAlgorithm but the caller has to hold `algorithmsMu`.
+func lookupAlgorithmLocked(name string) (algorithm, bool) {
+	if a, ok := algorithms[name]; ok {
+		return a, true
+	}
+	for _, n := range algorithmNames {
+		if strings.EqualFold(n, name) {
+			return algorithms[n], true
+		}
+	}
+	return algorithm{}, false
+}
+
+// algorithmError returns an error telling that `name` is not a recognized algorithm.
+func algorithmError(name string) error {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	quoted := make([]string, len(algorithmNames))
+	for i, n := range algorithmNames {
+		quoted[i] = strconv.Quote(n)
+	}
+	list := strings.Join(quoted[:len(quoted)-1], ", ") + ", or " + quoted[len(quoted)-1]
+	return errorf(ErrInvalidAlgorithm, "Algorithm have to be one of %v. Got %q", list, name)
+}
+
 // NewToken returns a new virtual TOTP token with parameters specified by a Key URI.
 // The Key URI format is defined in https://github.com/google/google-authenticator/wiki/Key-Uri-Format.
+// Both "otpauth://totp/..." and "otpauth://hotp/..." URIs are accepted.
 //
 // Users of this library have to specify at least `secret` in query parameter as defined in the spec.
 // Other parameters have default values like below:
 //   * issuer    = ""
-//   * algorithm = "SHA1" (Other available options are "SHA256" and "SHA512")
+//   * algorithm = "SHA1" (Other available options are "SHA256", "SHA512", "SHA3-256", "SHA3-512", and the ones
+//     registered with RegisterAlgorithm. Names are matched case-insensitively)
 //   * digits    = 6
 //   * period    = 30
 //
 // `digits` and `period` have a limited range as below:
-//   * 6 <= digits <= 10
-//   * 1 <= period <= 90
+//   * 6 <= digits <= 10 (The bounds can be changed by WithMinDigits and WithMaxDigits)
+//   * 1 <= period <= 90 (The upper bound can be changed by WithMaxPeriod)
+//
+// When both the issuer prefix of the label and the `issuer` query parameter are present, they have to agree as the
+// spec recommends. Pass WithLenientIssuer to prefer the query parameter instead. Slashes inside the label have to be
+// URL-encoded as "%2F".
 //
-// NewToken doesn't panic and merely returns an error should there be any violation in a Key URI passed.
-func NewToken(uri string) (*Token, error) {
+// Stray noise often found in scanned QR codes is tolerated: repeated slashes around the label and a trailing fragment
+// like "#foo" are ignored.
+//
+// `opts` specify the default values of parameters absent in the Key URI and how strictly the Key URI is validated.
+//
+// NewToken doesn't panic and merely returns an error should there be any violation in a Key URI passed. Such errors are
+// of type *ParseError. Errors on invalid `opts`, e.g. WithDigits(3), are returned as they are and aren't of that type,
+// as they don't concern the Key URI.
+func NewToken(uri string, opts ...Option) (*Token, error) {
+	o, err := applyOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Token{}
+	if err := parseURI(t, uri, o); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ValidateURI reports whether `uri` is a valid Key URI by running the same checks as NewToken with `opts`. It returns
+// the first violation found, which is of type *ParseError, or nil. An error on invalid `opts` is returned as NewToken
+// does. No Token is built, and the decoded secret is wiped before returning.
+func ValidateURI(uri string, opts ...Option) error {
+	o, err := applyOptions(opts)
+	if err != nil {
+		return err
+	}
+	var t Token
+	err = parseURI(&t, uri, o)
+	for i := range t.secret {
+		t.secret[i] = 0
+	}
+	return err
+}
+
+// parseURI parses a Key URI into `t`, which has to be a zero Token, with `o` specifying the default values.
+func parseURI(t *Token, uri string, o *options) error {
 	u, err := url.Parse(uri)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to parse URI %q", uri)
+		return &ParseError{Field: "uri", Value: uri, URI: uri, Err: errorf(ErrInvalidURI, "Failed to parse URI")}
 	}
 	if u.Scheme != "otpauth" {
-		return nil, fmt.Errorf("Scheme have to be \"otpauth\". Got %q. URI: %q", u.Scheme, uri)
+		err := errorf(ErrInvalidScheme, "Scheme have to be \"otpauth\". Got %q", u.Scheme)
+		return &ParseError{Field: "scheme", Value: u.Scheme, URI: uri, Err: err}
 	}
-	if u.Host != "totp" {
-		return nil, fmt.Errorf("Host have to be \"totp\". Got %q. URI: %q", u.Host, uri)
+	typ, escapedPath := u.Host, u.EscapedPath()
+	// Some exporters put the type in the first path element like "otpauth:///totp/alice@google.com?...".
+	if o.lenientHost && typ == "" {
+		first, rest, _ := strings.Cut(strings.TrimLeft(escapedPath, "/"), "/")
+		if first == typeTOTP || first == typeHOTP {
+			typ, escapedPath = first, rest
+		}
 	}
-
-	// Initialize Token
-	t := &Token{
-		algorithm: algorithmDefault,
-		digits:    digitsDefault,
-		period:    periodDefault,
+	if typ != typeTOTP && typ != typeHOTP {
+		err := errorf(ErrInvalidHost, "Host have to be \"totp\" or \"hotp\". Got %q", u.Host)
+		return &ParseError{Field: "host", Value: u.Host, URI: uri, Err: err}
 	}
 
+	initToken(t, typ, o)
+
 	// Process label
-	// `u.Path` might contain leading or trailing slashes.
-	t.label = strings.Trim(u.Path, "/")
+	// The fragment, if any, is ignored as it isn't part of the Key URI format.
+	// The path might contain leading or trailing slashes. They are trimmed before decoding so that URL-encoded
+	// slashes, which `u.Path` doesn't distinguish from literal ones, are kept in the label.
+	rawLabel := strings.Trim(escapedPath, "/")
+	// A literal slash inside the label would be taken as a path separator, so it has to be URL-encoded as "%2F".
+	if strings.Contains(rawLabel, "/") {
+		err := errorf(ErrInvalidURI, "Label %q have to URL-encode slashes as \"%%2F\"", rawLabel)
+		return &ParseError{Field: "label", Value: rawLabel, URI: uri, Err: err}
+	}
+	label, err := url.PathUnescape(rawLabel)
+	if err != nil {
+		err := errorf(ErrInvalidURI, "Label %q cannot be URL-decoded", escapedPath)
+		return &ParseError{Field: "label", Value: escapedPath, URI: uri, Err: err}
+	}
+	if label != "" {
+		t.label = label
+	}
+
+	return parseValues(t, u.Query(), uri, o)
+}
+
+// initToken initializes `t` as a token of type `typ` with the default values `o` specifies.
+func initToken(t *Token, typ string, o *options) {
+	t.typ = typ
+	t.label = o.label
+	t.issuer = o.issuer
+	t.algorithm = o.algorithm
+	t.digits = o.digits
+	t.period = o.period
+	t.epoch = o.epoch
+	t.image = o.image
+	t.alphabet = o.alphabet
+	t.length = o.length
+	t.maxDigits = o.maxDigits
+	t.maxPeriod = o.maxPeriod
+}
+
+// parseValues parses the query parameters of a Key URI into `t`, which has been initialized by initToken. `uri` is
+// only used to report errors.
+func parseValues(t *Token, query url.Values, uri string, o *options) error {
+	// Duplicated parameters usually indicate corruption, but only the first ones are used unless WithStrictParams is
+	// given.
+	if o.strictParams {
+		for _, name := range knownParamNames {
+			if values := query[name]; len(values) > 1 {
+				err := errorf(ErrDuplicateParameter, "Query parameter %q have to appear at most once. Got %v times", name, len(values))
+				return &ParseError{Field: name, Value: values[1], URI: uri, Err: err}
+			}
+		}
+	}
 
 	// Process secret [REQUIRED]
-	if u.Query().Has("secret") {
-		rawSecret := u.Query().Get("secret")
-		// Empty string is unfortunately treated as a valid Base32 string by encoding/base32.
-		if rawSecret == "" {
-			return nil, fmt.Errorf("Secret is empty. URI: %q", uri)
-		}
-		upperSecret := strings.ToUpper(rawSecret)
-		secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(upperSecret)
+	if query.Has("secret") {
+		rawSecret := query.Get("secret")
+		var secret []byte
+		var err error
+		if o.base64Secrets && strings.EqualFold(query.Get("encoding"), "base64") {
+			secret, err = decodeSecretBase64(rawSecret)
+		} else {
+			secret, err = decodeSecret(rawSecret)
+			// Some issuers use Base64 without telling it.
+			if err != nil && o.base64Secrets {
+				if s, e := decodeSecretBase64(rawSecret); e == nil {
+					secret, err = s, nil
+				}
+			}
+		}
 		if err != nil {
-			return nil, fmt.Errorf("Failed to decode secret value %q as Base32 string. URI: %q", rawSecret, uri)
+			return &ParseError{Field: "secret", Value: rawSecret, URI: uri, Err: err}
+		}
+		secret = o.normalizeSecret(secret)
+		if err := o.checkSecret(secret); err != nil {
+			return &ParseError{Field: "secret", Value: rawSecret, URI: uri, Err: err}
 		}
 		t.secret = secret
 	} else {
-		return nil, fmt.Errorf("Secret is required in query parameter. URI: %q", uri)
+		err := errorf(ErrMissingSecret, "Secret is required in query parameter")
+		return &ParseError{Field: "secret", URI: uri, Err: err}
 	}
 
 	// Process issuer [OPTIONAL]
-	if u.Query().Has("issuer") {
-		t.issuer = u.Query().Get("issuer")
+	// The label might be prefixed with the issuer like "Example:alice@google.com". It is used when the query parameter
+	// is absent.
+	labelIssuer, account := splitLabel(t.label)
+	if query.Has("issuer") {
+		t.issuer = query.Get("issuer")
+		if !o.lenientIssuer && t.issuer != "" && labelIssuer != "" && t.issuer != labelIssuer {
+			err := errorf(ErrIssuerMismatch, "Issuer %q doesn't match the issuer prefix of the label %q", t.issuer, labelIssuer)
+			return &ParseError{Field: "issuer", Value: t.issuer, URI: uri, Err: err}
+		}
+	} else if labelIssuer != "" {
+		t.issuer = labelIssuer
+	}
+	// Some issuers omit the account name like "Example:". Such a label holds nothing but the issuer, which has been
+	// taken above, so it is dropped instead of keeping the dangling colon.
+	if labelIssuer != "" && account == "" {
+		t.label = ""
 	}
 
 	// Process algorithm [OPTIONAL]
-	if u.Query().Has("algorithm") {
-		rawAlgorithm := u.Query().Get("algorithm")
-		switch rawAlgorithm {
-		case "SHA1":
-			t.algorithm = algorithmSHA1
-		case "SHA256":
-			t.algorithm = algorithmSHA256
-		case "SHA512":
-			t.algorithm = algorithmSHA512
-		default:
-			return nil, fmt.Errorf("Algorithm have to be one of \"SHA1\", \"SHA256\", or \"SHA512\". Got %q. URI: %q", rawAlgorithm, uri)
+	if query.Has("algorithm") {
+		rawAlgorithm := query.Get("algorithm")
+		algorithm, ok := lookupAlgorithm(rawAlgorithm)
+		if !ok {
+			return &ParseError{Field: "algorithm", Value: rawAlgorithm, URI: uri, Err: algorithmError(rawAlgorithm)}
 		}
+		t.algorithm = algorithm
 	}
 
 	// Process digits [OPTIONAL]
-	if u.Query().Has("digits") {
-		rawDigits := u.Query().Get("digits")
+	if query.Has("digits") {
+		rawDigits := query.Get("digits")
 		digits, err := strconv.Atoi(rawDigits)
 		if err != nil {
-			return nil, fmt.Errorf("Digits %q cannot be converted into an integer. URI: %q", rawDigits, uri)
+			err := errorf(ErrInvalidDigits, "Digits %q cannot be converted into an integer", rawDigits)
+			return &ParseError{Field: "digits", Value: rawDigits, URI: uri, Err: err}
 		}
-		if digits < digitsMin || digits > digitsMax {
-			return nil, fmt.Errorf("Digits have to be in the range of [%v, %v]. Got %v. URI: %q", digitsMin, digitsMax, digits, uri)
+		if err := o.checkDigits(digits); err != nil {
+			return &ParseError{Field: "digits", Value: rawDigits, URI: uri, Err: err}
 		}
 		t.digits = digits
+	} else if err := o.checkDigits(t.digits); err != nil {
+		// The default might be out of the range narrowed by WithMinDigits.
+		return &ParseError{Field: "digits", URI: uri, Err: err}
+	}
+
+	// Process counter [REQUIRED if hotp]
+	if t.typ == typeHOTP {
+		if query.Has("counter") {
+			rawCounter := query.Get("counter")
+			counter, err := strconv.ParseUint(rawCounter, 10, 64)
+			if err != nil {
+				err := errorf(ErrInvalidCounter, "Counter %q cannot be converted into an unsigned 64-bit integer", rawCounter)
+				return &ParseError{Field: "counter", Value: rawCounter, URI: uri, Err: err}
+			}
+			t.counter = counter
+		} else {
+			err := errorf(ErrMissingCounter, "Counter is required in query parameter for HOTP")
+			return &ParseError{Field: "counter", URI: uri, Err: err}
+		}
 	}
 
 	// Process period [OPTIONAL]
-	if u.Query().Has("period") {
-		rawPeriod := u.Query().Get("period")
+	if query.Has("period") {
+		rawPeriod := query.Get("period")
 		period, err := strconv.Atoi(rawPeriod)
 		if err != nil {
-			return nil, fmt.Errorf("Period %q cannot be converted into an integer. URI: %q", rawPeriod, uri)
+			err := errorf(ErrInvalidPeriod, "Period %q cannot be converted into an integer", rawPeriod)
+			return &ParseError{Field: "period", Value: rawPeriod, URI: uri, Err: err}
 		}
-		if period < periodMin || period > periodMax {
-			return nil, fmt.Errorf("Period have to be in the range of [%v, %v]. Got %v. URI: %q", periodMin, periodMax, period, uri)
+		if period < PeriodMin || period > o.maxPeriod {
+			err := errorf(ErrPeriodOutOfRange, "Period have to be in the range of [%v, %v]. Got %v", PeriodMin, o.maxPeriod, period)
+			return &ParseError{Field: "period", Value: rawPeriod, URI: uri, Err: err}
 		}
 		t.period = period
 	}
 
+	// Process image [OPTIONAL]
+	// It is not part of the Key URI format, but some issuers use it to provide their logo.
+	if query.Has("image") {
+		rawImage := query.Get("image")
+		if err := checkImage(rawImage); err != nil {
+			return &ParseError{Field: "image", Value: rawImage, URI: uri, Err: err}
+		}
+		t.image = rawImage
+	}
+
+	// Process unknown parameters [OPTIONAL]
+	// Some issuers add non-standard parameters, which are kept unless WithStrictParams is given.
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if knownParams[name] || name == "encoding" && o.base64Secrets {
+			continue
+		}
+		if o.strictParams {
+			err := errorf(ErrUnknownParameter, "Query parameter %q is not defined in the Key URI format", name)
+			return &ParseError{Field: name, Value: query.Get(name), URI: uri, Err: err}
+		}
+		if t.extraParams == nil {
+			t.extraParams = url.Values{}
+		}
+		t.extraParams[name] = append([]string(nil), query[name]...)
+	}
+
+	return nil
+}
+
+// knownParamNames holds the query parameters defined in the Key URI format in the order they are processed.
+var knownParamNames = []string{"secret", "issuer", "algorithm", "digits", "counter", "period", "image"}
+
+// knownParams holds the query parameters defined in the Key URI format.
+var knownParams = func() map[string]bool {
+	m := map[string]bool{}
+	for _, name := range knownParamNames {
+		m[name] = true
+	}
+	return m
+}()
+
+// EncodeSecret encodes a raw secret as an uppercase Base32 string without padding, exactly as String and SecretBase32
+// do. It is handy when secrets are stored separately from tokens.
+func EncodeSecret(secret []byte) string {
+	return encodeSecret(secret)
+}
+
+// DecodeSecret decodes a Base32 secret exactly as NewToken does. Lowercase letters, "=" padding, whitespace, and "-"
+// are accepted. The returned error wraps ErrInvalidSecret when `s` is empty or not a valid Base32 string.
+func DecodeSecret(s string) ([]byte, error) {
+	return decodeSecret(s)
+}
+
+// decodeSecret decodes a Base32 secret as it appears in a Key URI.
+func decodeSecret(rawSecret string) ([]byte, error) {
+	// Secrets are often grouped like "GEZD GNBV GY3T" or "GEZD-GNBV-GY3T" for readability. The separators are removed
+	// here, and any other invalid character is still rejected by the decoder.
+	compactSecret := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return r
+	}, rawSecret)
+	// Some exporters append "=" padding, which is stripped here so that both padded and unpadded secrets are accepted.
+	upperSecret := strings.TrimRight(strings.ToUpper(compactSecret), "=")
+	// Empty string is unfortunately treated as a valid Base32 string by encoding/base32.
+	if upperSecret == "" {
+		return nil, errorf(ErrInvalidSecret, "Secret is empty")
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(upperSecret)
+	// A single trailing character doesn't make a byte, so it might be decoded into nothing without an error.
+	if err != nil || len(secret) == 0 {
+		return nil, errorf(ErrInvalidSecret, "Failed to decode secret value %q as Base32 string", rawSecret)
+	}
+	return secret, nil
+}
+
+// decodeSecretBase64 decodes a secret encoded as a URL-safe Base64 string with or without padding, which some
+// non-standard issuers use instead of Base32.
+func decodeSecretBase64(rawSecret string) ([]byte, error) {
+	trimmedSecret := strings.TrimRight(rawSecret, "=")
+	if trimmedSecret == "" {
+		return nil, errorf(ErrInvalidSecret, "Secret is empty")
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(trimmedSecret)
+	if err != nil || len(secret) == 0 {
+		return nil, errorf(ErrInvalidSecret, "Failed to decode secret value %q as URL-safe Base64 string", rawSecret)
+	}
+	return secret, nil
+}
+
+// encodeSecret encodes a secret as an uppercase Base32 string without padding as it appears in a Key URI.
+func encodeSecret(secret []byte) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+}
+
+// NewTokenFromParams returns a new virtual TOTP token with a raw `secret` and parameters specified by `opts`.
+// It is handy when the parameters are already at hand and there's no need to build and parse a Key URI.
+//
+// Parameters not specified by `opts` have the same default values as NewToken, and the same validation rules are
+// applied. `secret` is copied, so modifying it afterward doesn't affect the returned token.
+func NewTokenFromParams(secret []byte, opts ...Option) (*Token, error) {
+	if len(secret) == 0 {
+		return nil, errorf(ErrMissingSecret, "Secret is empty")
+	}
+
+	o, err := applyOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	secret = o.normalizeSecret(secret)
+	if err := o.checkDigits(o.digits); err != nil {
+		return nil, err
+	}
+	if err := o.checkSecret(secret); err != nil {
+		return nil, err
+	}
+
+	t := &Token{
+		typ:       typeTOTP,
+		label:     o.label,
+		secret:    append([]byte(nil), secret...),
+		issuer:    o.issuer,
+		algorithm: o.algorithm,
+		digits:    o.digits,
+		period:    o.period,
+		epoch:     o.epoch,
+		image:     o.image,
+		alphabet:  o.alphabet,
+		length:    o.length,
+		maxDigits: o.maxDigits,
+		maxPeriod: o.maxPeriod,
+	}
 	return t, nil
 }
 
+// NewTokenFromValues works like NewToken but takes the label and the query parameters of a Key URI separately, e.g. as
+// submitted by a web form, which saves building and parsing a Key URI. `values` are validated in the same way as
+// NewToken does. The returned token is of type "totp", and `label` is used as it is without URL-decoding. So `counter`,
+// which only HOTP tokens have, is rejected rather than ignored.
+//
+// Errors on `values` are of type *ParseError with an empty URI.
+func NewTokenFromValues(label string, values url.Values, opts ...Option) (*Token, error) {
+	o, err := applyOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if values.Has("counter") {
+		err := errorf(ErrInvalidCounter, "Counter is only allowed for HOTP, while the token is TOTP")
+		return nil, &ParseError{Field: "counter", Value: values.Get("counter"), Err: err}
+	}
+	t := &Token{}
+	initToken(t, typeTOTP, o)
+	if label != "" {
+		t.label = label
+	}
+	if err := parseValues(t, values, "", o); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// NewTokenFromSecretHex works like NewTokenFromParams but takes a hex-encoded secret such as
+// "3132333435363738393031323334353637383930", which is the form the test vectors in RFC 6238 use.
+func NewTokenFromSecretHex(hexSecret string, opts ...Option) (*Token, error) {
+	secret, err := hex.DecodeString(hexSecret)
+	if err != nil {
+		return nil, errorf(ErrInvalidSecret, "Failed to decode secret value %q as hex string", hexSecret)
+	}
+	return NewTokenFromParams(secret, opts...)
+}
+
+// NewTokenFromSecretReader works like NewTokenFromParams but reads the raw secret from `r` until EOF, which decouples
+// acquiring the secret from encoding it. The secret has to be at most 1024 bytes long, and no more bytes than that are
+// read from `r`.
+func NewTokenFromSecretReader(r io.Reader, opts ...Option) (*Token, error) {
+	secret, err := io.ReadAll(io.LimitReader(r, secretBytesMax+1))
+	defer func() {
+		for i := range secret {
+			secret[i] = 0
+		}
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read secret: %w", err)
+	}
+	if len(secret) > secretBytesMax {
+		return nil, errorf(ErrInvalidSecret, "Secret have to be at most %v bytes long", secretBytesMax)
+	}
+	return NewTokenFromParams(secret, opts...)
+}
+
+// NewRandomToken returns a new virtual TOTP token with a secret read from crypto/rand and parameters specified by
+// `opts`. The secret is 160 bits long unless another length is given by WithSecretBits, and another source of
+// randomness can be given by WithRandSource.
+//
+// It is meant for enrollment: show the secret to the user by SecretBase32 or a QR code of the Key URI String returns.
+func NewRandomToken(opts ...Option) (*Token, error) {
+	o, err := applyOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomSecret(o.secretBits, o.rand)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for i := range secret {
+			secret[i] = 0
+		}
+	}()
+	return NewTokenFromParams(secret, opts...)
+}
+
+// GenerateSecret returns a random secret of `bits` bits read from crypto/rand as an uppercase Base32 string without
+// padding, which can be stored before binding it to an account or typed into an authenticator app.
+// `bits` has to be a multiple of 8 and at least 128 as RFC 4226 requires. 160 is recommended.
+func GenerateSecret(bits int) (string, error) {
+	if err := checkSecretBits(bits); err != nil {
+		return "", err
+	}
+	secret, err := randomSecret(bits, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		for i := range secret {
+			secret[i] = 0
+		}
+	}()
+	return encodeSecret(secret), nil
+}
+
+// randomSecret returns a secret of `bits` bits read from `r`. `bits` has to be a multiple of 8.
+func randomSecret(bits int, r io.Reader) ([]byte, error) {
+	secret := make([]byte, bits/8)
+	if _, err := io.ReadFull(r, secret); err != nil {
+		return nil, fmt.Errorf("Failed to read random secret: %w", err)
+	}
+	return secret, nil
+}
+
+// checkSecretBits checks that a secret of `bits` bits can be generated.
+func checkSecretBits(bits int) error {
+	if bits%8 != 0 || bits < secretBitsMin {
+		return fmt.Errorf("Secret bits have to be a multiple of 8 and at least %v. Got %v", secretBitsMin, bits)
+	}
+	return nil
+}
+
+// Valid checks that the token is well-formed and returns an error describing the first violation, or nil. It is handy
+// to guard against corrupted state of a token restored from storage. The secret has to be non-empty, the digits and
+// the period have to be in the ranges the constructors accept with WithMaxDigits and WithMaxPeriod, i.e. [6, 18] and
+// [1, 2147483647], and the algorithm has to be a built-in or registered one.
+func (t *Token) Valid() error {
+	if t == nil {
+		return errorf(ErrMissingSecret, "Token is nil")
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.typ != typeTOTP && t.typ != typeHOTP {
+		return errorf(ErrInvalidHost, "Type have to be \"totp\" or \"hotp\". Got %q", t.typ)
+	}
+	if len(t.secret) == 0 {
+		return errorf(ErrMissingSecret, "Secret is empty")
+	}
+	if t.digits < DigitsMin || t.digits > digitsLimit {
+		return errorf(ErrDigitsOutOfRange, "Digits have to be in the range of [%v, %v]. Got %v", DigitsMin, digitsLimit, t.digits)
+	}
+	if t.period < PeriodMin || t.period > periodLimit {
+		return errorf(ErrPeriodOutOfRange, "Period have to be in the range of [%v, %v]. Got %v", PeriodMin, periodLimit, t.period)
+	}
+	if _, ok := lookupAlgorithm(t.algorithm.name); !ok || t.algorithm.proc == nil {
+		return algorithmError(t.algorithm.name)
+	}
+	return nil
+}
+
+// Warnings returns advisory messages about settings that are valid but unusual, such as 7 digits or a period of 45
+// seconds, which many authenticator apps don't support or silently ignore. Enrollment flows can show them to caution
+// users. It returns nil when the token only uses widely supported settings. Validation isn't affected by them.
+func (t *Token) Warnings() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var warnings []string
+	if t.alphabet != "" {
+		warnings = append(warnings, "Custom alphabet is not supported by most authenticator apps")
+	} else if t.digits != 6 && t.digits != 8 {
+		warnings = append(warnings, fmt.Sprintf("Digits other than 6 and 8 are not supported by most authenticator apps. Got %v", t.digits))
+	}
+	if t.typ == typeTOTP && t.period != periodDefault {
+		warnings = append(warnings, fmt.Sprintf("Period other than %v is not supported by most authenticator apps. Got %v", periodDefault, t.period))
+	}
+	switch t.algorithm.name {
+	case algorithmSHA1.name:
+	case algorithmSHA256.name, algorithmSHA512.name:
+		warnings = append(warnings, fmt.Sprintf("Algorithm %q is ignored by some authenticator apps, which use \"SHA1\" instead", t.algorithm.name))
+	default:
+		warnings = append(warnings, fmt.Sprintf("Algorithm %q is not supported by most authenticator apps", t.algorithm.name))
+	}
+	if bits := len(t.secret) * 8; bits < secretBitsMin {
+		warnings = append(warnings, fmt.Sprintf("Secret is shorter than %v bits RFC 4226 requires. Got %v bits", secretBitsMin, bits))
+	}
+	return warnings
+}
+
+// TokenInfo is a snapshot of the public details of a Token, which is handy to render them, e.g. in templates, without
+// exposing the Token itself. It doesn't include the secret.
+type TokenInfo struct {
+	Label       string
+	Issuer      string
+	AccountName string
+	Algorithm   string
+	Digits      int
+	Period      int
+}
+
+// Info returns the details of the token at once. The fields hold the same values as the corresponding getters, taken
+// consistently even if the token is modified concurrently.
+func (t *Token) Info() TokenInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, account := splitLabel(t.label)
+	return TokenInfo{
+		Label:       t.label,
+		Issuer:      t.issuer,
+		AccountName: account,
+		Algorithm:   t.algorithm.name,
+		Digits:      t.digits,
+		Period:      t.period,
+	}
+}
+
+// Type returns the type of the token, which is the host of the Key URI: "totp" or "hotp". Time-based OTPs of "totp"
+// tokens are generated by Generate, and counter-based OTPs of "hotp" tokens by GenerateHOTP.
+func (t *Token) Type() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.typ
+}
+
 // Label returns the label part of the Key URI without leading or trailing slashes.
 func (t *Token) Label() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.label
 }
 
 // Issuer returns the issuer value of the Key URI.
+// When the `issuer` query parameter is absent, the issuer prefix of the label is returned instead.
 func (t *Token) Issuer() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.issuer
 }
 
+// AccountName returns the account name part of the label, i.e. the label without the issuer prefix.
+// For example, it returns "alice@google.com" for the label "Example:alice@google.com". The whole label is returned
+// when it has no colon. Unlike Label, leading spaces after the colon are removed.
+func (t *Token) AccountName() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, account := splitLabel(t.label)
+	return account
+}
+
+// splitLabel splits a label into the issuer prefix and the account name at the first colon.
+// The spec allows optional spaces between the colon and the account name, which are removed.
+func splitLabel(label string) (issuer, account string) {
+	i := strings.Index(label, ":")
+	if i < 0 {
+		return "", label
+	}
+	return label[:i], strings.TrimLeft(label[i+1:], " ")
+}
+
 // Algorithm returns the hash function name used to generate TOTPs.
-// It should return "SHA1", "SHA256", or "SHA512".
+// It should return "SHA1", "SHA256", "SHA512", "SHA3-256", "SHA3-512", or the name of a registered algorithm.
 func (t *Token) Algorithm() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.algorithm.name
 }
 
+// TypedAlgorithm works like Algorithm but returns the name as an Algorithm, which can be compared with the constants
+// like AlgorithmSHA256.
+func (t *Token) TypedAlgorithm() Algorithm {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return Algorithm(t.algorithm.name)
+}
+
 // Digits returns the number of digits OTPs have.
+// It is not used when OTPs are rendered in a custom alphabet set by WithAlphabet.
 func (t *Token) Digits() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.digits
 }
 
 // Period returns the time duration in seconds a TOTP lives.
 func (t *Token) Period() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.period
 }
 
+// PeriodDuration returns the time duration a TOTP lives as a time.Duration.
+func (t *Token) PeriodDuration() time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.periodDuration()
+}
+
+func (t *Token) periodDuration() time.Duration {
+	return time.Duration(t.period) * time.Second
+}
+
+// SecretBase32 returns the secret as an uppercase Base32 string without padding as it appears in a Key URI.
+// It is handy for enrollment flows where users type the secret instead of scanning a QR code.
+func (t *Token) SecretBase32() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return encodeSecret(t.secret)
+}
+
+// SecretBytes returns a copy of the raw secret. Modifying the returned slice doesn't affect the token.
+// The caller is responsible for wiping the copy once it is no longer needed.
+func (t *Token) SecretBytes() []byte {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]byte(nil), t.secret...)
+}
+
+// Image returns the URL of the issuer's logo given by the `image` query parameter or WithImage. It returns an empty
+// string when there's none.
+func (t *Token) Image() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.image
+}
+
+// InitialCounter returns the counter value of the Key URI for HOTP. It is always 0 for TOTP.
+func (t *Token) InitialCounter() uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.counter
+}
+
+// WithClock sets the clock the token uses to get the current time in Now.
+// Passing nil restores the default clock, which returns the real current time.
+func (t *Token) WithClock(c Clock) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clock = c
+}
+
+// SetDigits changes the number of digits OTPs have. `digits` is validated like WithDigits against the upper bound the
+// token was built with, e.g. by WithMaxDigits, and the token is left unchanged on error.
+func (t *Token) SetDigits(digits int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o, err := applyOptions([]Option{WithMaxDigits(t.digitsBound()), WithDigits(digits)})
+	if err != nil {
+		return err
+	}
+	t.digits = o.digits
+	return nil
+}
+
+// digitsBound returns the upper bound of digits of the token, which is never below the default one.
+func (t *Token) digitsBound() int {
+	if t.maxDigits < DigitsMax {
+		return DigitsMax
+	}
+	return t.maxDigits
+}
+
+// SetPeriod changes the time duration in seconds a TOTP lives. `period` is validated like WithPeriod against the upper
+// bound the token was built with, e.g. by WithMaxPeriod, and the token is left unchanged on error.
+func (t *Token) SetPeriod(period int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o, err := applyOptions([]Option{WithMaxPeriod(t.periodBound()), WithPeriod(period)})
+	if err != nil {
+		return err
+	}
+	t.period = o.period
+	return nil
+}
+
+// periodBound returns the upper bound of the period of the token, which is never below the default one.
+func (t *Token) periodBound() int {
+	if t.maxPeriod < PeriodMax {
+		return PeriodMax
+	}
+	return t.maxPeriod
+}
+
+// SetAlgorithm changes the hash function used to generate OTPs. `name` is validated like WithAlgorithm, and the token
+// is left unchanged on error.
+func (t *Token) SetAlgorithm(name string) error {
+	o, err := applyOptions([]Option{WithAlgorithm(name)})
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.algorithm = o.algorithm
+	t.generation++
+	t.mu.Unlock()
+	return nil
+}
+
+// SetIssuer changes the issuer of the token. The label is left as is.
+func (t *Token) SetIssuer(issuer string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.issuer = issuer
+}
+
+// Destroy overwrites the token's secret with zeros and drops it. After that, the token generates no OTPs: Generate
+// and its variants return an empty string, and verification always fails.
+//
+// This is a best-effort measure. The Go runtime might have copied the secret elsewhere in memory, e.g. while growing
+// a slice or moving a stack, and such copies cannot be wiped. The same goes for HMAC states derived from the secret,
+// which are cached for performance and dropped here.
+func (t *Token) Destroy() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.secret {
+		t.secret[i] = 0
+	}
+	t.secret = nil
+	t.generation++
+	// Drain the cache. States held by other Ps might survive, but they are never used again.
+	for t.macs.Get() != nil {
+	}
+}
+
+// Clone returns a deep copy of the token. The copy has its own secret, so mutating or destroying either token doesn't
+// affect the other. The clock is shared.
+func (t *Token) Clone() *Token {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	c := &Token{}
+	c.assign(t)
+	if t.secret != nil {
+		c.secret = append([]byte{}, t.secret...)
+	}
+	return c
+}
+
+// assign overwrites the fields of `t` with those of `src`. The secret is shared rather than copied.
+// The caller has to hold the lock of `src` if it might be used concurrently.
+func (t *Token) assign(src *Token) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.typ = src.typ
+	t.label = src.label
+	t.secret = src.secret
+	t.issuer = src.issuer
+	t.algorithm = src.algorithm
+	t.digits = src.digits
+	t.period = src.period
+	t.counter = src.counter
+	t.epoch = src.epoch
+	t.image = src.image
+	t.clock = src.clock
+	t.alphabet = src.alphabet
+	t.length = src.length
+	t.maxDigits = src.maxDigits
+	t.maxPeriod = src.maxPeriod
+	t.extraParams = src.extraParams
+	t.generation++
+}
+
+// Equal reports whether `t` and `other` are equivalent, i.e. they have the same label, issuer, and parameters and
+// generate the same OTPs. The secrets are compared in constant time. Two nil tokens are equal, but a nil token is not
+// equal to a non-nil one.
+func (t *Token) Equal(other *Token) bool {
+	if t == nil || other == nil || t == other {
+		return t == other
+	}
+	// Compare against a snapshot so that the locks of both tokens are never held at once.
+	other = other.Clone()
+	defer other.Destroy()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.typ == other.typ &&
+		t.label == other.label &&
+		t.issuer == other.issuer &&
+		t.algorithm.name == other.algorithm.name &&
+		t.digits == other.digits &&
+		t.period == other.period &&
+		t.epoch == other.epoch &&
+		t.counter == other.counter &&
+		t.alphabet == other.alphabet &&
+		t.length == other.length &&
+		subtle.ConstantTimeCompare(t.secret, other.secret) == 1
+}
+
+// String returns the Key URI representing the token, e.g.
+// "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&algorithm=SHA1&digits=6&period=30".
+//
+// The secret is encoded as an uppercase Base32 string without padding, and the label and issuer are URL-encoded.
+// Query parameters NewToken didn't recognize follow the standard ones in the order of their names.
+// Passing the returned URI to NewToken yields an equivalent token, provided that WithMaxDigits and WithMaxPeriod are
+// given as well when the token has more than 10 digits or a period longer than 90 seconds, and WithLenientIssuer when
+// the issuer differs from the issuer prefix of the label, e.g. after SetIssuer. UnmarshalText takes care of them by
+// itself.
+func (t *Token) String() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.uri(t.label, t.issuer)
+}
+
+// URIWithLabel works like String but puts `label` and `issuer` into the Key URI instead of the token's own ones, e.g.
+// to show a display-friendly label on enrollment. The token itself isn't modified. `issuer` is omitted when it's empty.
+//
+// NewToken rejects the returned URI when the issuer prefix of `label` differs from `issuer` unless WithLenientIssuer
+// is given.
+func (t *Token) URIWithLabel(label, issuer string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.uri(label, issuer)
+}
+
+// uri returns the Key URI representing the token with `label` and `issuer`.
+func (t *Token) uri(label, issuer string) string {
+	params := []string{"secret=" + encodeSecret(t.secret)}
+	if issuer != "" {
+		params = append(params, "issuer="+escapeQuery(issuer))
+	}
+	params = append(params, "algorithm="+t.algorithm.name)
+	params = append(params, "digits="+strconv.Itoa(t.digits))
+	if t.typ == typeHOTP {
+		params = append(params, "counter="+strconv.FormatUint(t.counter, 10))
+	} else {
+		params = append(params, "period="+strconv.Itoa(t.period))
+	}
+	if t.image != "" {
+		params = append(params, "image="+escapeQuery(t.image))
+	}
+	// Unknown parameters follow in the order of their names.
+	names := make([]string, 0, len(t.extraParams))
+	for name := range t.extraParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range t.extraParams[name] {
+			params = append(params, escapeQuery(name)+"="+escapeQuery(v))
+		}
+	}
+	return "otpauth://" + t.typ + "/" + url.PathEscape(label) + "?" + strings.Join(params, "&")
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. The text form of a token is its Key URI.
+//
+// The Key URI format cannot represent an epoch set by WithEpoch or an alphabet set by WithAlphabet, so an error is
+// returned for such a token rather than silently dropping them. Use MarshalJSON for it instead.
+func (t *Token) MarshalText() ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.epoch != 0 {
+		return nil, fmt.Errorf("Epoch %v cannot be represented in a Key URI", time.Unix(t.epoch, 0).UTC())
+	}
+	if t.alphabet != "" {
+		return nil, fmt.Errorf("Alphabet %q cannot be represented in a Key URI", t.alphabet)
+	}
+	return []byte(t.uri(t.label, t.issuer)), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. `text` is parsed as a Key URI by NewToken, except
+// that any digits, period, and issuer MarshalText might have emitted are accepted.
+func (t *Token) UnmarshalText(text []byte) error {
+	// The digits and the period might have been allowed by WithMaxDigits and WithMaxPeriod when the token was built, and
+	// the issuer might differ from the issuer prefix of the label, e.g. after SetIssuer.
+	tk, err := NewToken(string(text), WithMaxDigits(digitsLimit), WithMaxPeriod(periodLimit), WithLenientIssuer())
+	if err != nil {
+		return err
+	}
+	tk.fitBounds()
+	t.assign(tk)
+	return nil
+}
+
+// fitBounds narrows the upper bounds of a token restored from its serialized form, which doesn't record them, to the
+// smallest ones that still admit its parameters, so that the setters don't accept more than the original token did.
+func (t *Token) fitBounds() {
+	t.maxDigits = DigitsMax
+	if t.digits > t.maxDigits {
+		t.maxDigits = t.digits
+	}
+	t.maxPeriod = PeriodMax
+	if t.period > t.maxPeriod {
+		t.maxPeriod = t.period
+	}
+}
+
+// escapeQuery escapes `s` so that it can be placed in a query parameter.
+// Spaces are encoded as "%20" rather than "+" as recommended by the Key URI format.
+func escapeQuery(s string) string {
+	// `url.QueryEscape()` encodes a literal "+" as "%2B", so every remaining "+" stands for a space.
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
 // Generate returns a TOTP value calculated with the token's parameters and a specified time.
+//
+// Periods are half-open: a period starting at `s` covers `[s, s + period)`. So when `m` lands exactly on a boundary,
+// i.e. `(m.Unix() - T0) % period == 0`, the TOTP of the new period is returned, and TimeRemaining returns the full
+// period for it.
 func (t *Token) Generate(m time.Time) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.generate(t.step(m))
+}
+
+// GenerateContext works like Generate but returns `ctx.Err()` instead of a TOTP value when `ctx` has already been
+// canceled or its deadline has passed. It is handy when OTPs are generated as part of a cancelable pipeline.
+func (t *Token) GenerateContext(ctx context.Context, m time.Time) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return t.Generate(m), nil
+}
+
+// Now returns a TOTP value for the current time provided by the token's clock.
+// It is equivalent to `t.Generate(time.Now())` unless another clock is set with WithClock.
+func (t *Token) Now() string {
+	t.mu.RLock()
+	c := t.clock
+	t.mu.RUnlock()
+	if c == nil {
+		c = realClock{}
+	}
+	return t.Generate(c.Now())
+}
+
+// GenerateWithExpiry returns a TOTP value for a specified time together with the time it expires at, i.e. the start
+// of the next period. `expiresAt` is in the same location as `m`.
+func (t *Token) GenerateWithExpiry(m time.Time) (code string, expiresAt time.Time) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	u := t.step(m)
+	return t.generate(u), t.stepStart(u + 1).In(m.Location())
+}
+
+// GenerateInt returns a TOTP value for a specified time as an integer, i.e. without zero-padding to the token's digits.
+// It is handy to store OTPs compactly or to format them in a custom way. The value is always rendered in decimal
+// regardless of WithAlphabet, and it is 0 after the token has been destroyed by Destroy.
+func (t *Token) GenerateInt(m time.Time) uint32 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.generateInt(t.step(m))
+}
+
+// GenerateCurrentAndNext returns TOTP values for the period containing a specified time and the subsequent period,
+// which authenticator apps often show as a preview.
+func (t *Token) GenerateCurrentAndNext(m time.Time) (current, next string) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	u := t.step(m)
+	return t.generate(u), t.generate(u + 1)
+}
+
+// GenerateFormatted returns a TOTP value for a specified time with `sep` inserted every `groupSize` characters from the
+// left for readability, e.g. "123 456" for `groupSize` = 3 and `sep` = " ". A non-positive `groupSize` returns the
+// value as Generate does. Grouping doesn't alter the characters of the value, so Verify accepts it once the
+// separators are removed.
+func (t *Token) GenerateFormatted(m time.Time, groupSize int, sep string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	code := t.generate(t.step(m))
+	if groupSize <= 0 {
+		return code
+	}
+	chars := []rune(code)
+	var b strings.Builder
+	for i, c := range chars {
+		if i > 0 && i%groupSize == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// GenerateOffset returns the TOTP value for the period `steps` periods after the one containing a specified time, or
+// before it when `steps` is negative. `steps` = 0 is equivalent to Generate. It is handy to preview upcoming codes or
+// to see which codes a skew window accepts.
+func (t *Token) GenerateOffset(m time.Time, steps int) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.generate(t.step(m) + int64(steps))
+}
+
+// GenerateRange returns TOTP values for every period overlapping the time range [`start`, `end`) in chronological
+// order. The first value is for the period containing `start`, which might have begun before `start`. It returns nil
+// when `end` is not after `start`, or when the range overlaps more than 10000 periods, e.g. about 3.5 days of 30-second
+// periods.
+func (t *Token) GenerateRange(start, end time.Time) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	// The secret has been wiped by Destroy.
+	if !end.After(start) || len(t.secret) == 0 {
+		return nil
+	}
+	first := t.step(start)
+	// `end` is exclusive, so the last period is the one containing the instant right before `end`.
+	last := t.step(end.Add(-time.Nanosecond))
+	// `last` is never less than `first`, so the difference is right as an unsigned integer even if it overflows int64.
+	if uint64(last-first) >= generateRangeMax {
+		return nil
+	}
+
+	// A single HMAC state is reused for all the periods.
+	mac := t.acquireMAC()
+	defer t.releaseMAC(mac)
+	codes := make([]string, 0, last-first+1)
+	for u := first; u <= last; u++ {
+		codes = append(codes, t.render(truncateWith(mac.hash, message(u))))
+	}
+	return codes
+}
+
+// CandidateCodes returns the TOTP values VerifyWithSkew accepts for a specified time and `skew`, i.e. the ones for the
+// periods from `skew` before to `skew` after the one containing `m` in chronological order. A negative `skew` is
+// treated as 0. It returns nil when there would be more than 10000 values, i.e. `skew` is greater than 4999, as
+// GenerateRange does. It is meant for diagnosing why a code was rejected, so don't expose the result to users.
+func (t *Token) CandidateCodes(m time.Time, skew int) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	// The secret has been wiped by Destroy.
+	if len(t.secret) == 0 {
+		return nil
+	}
+	if skew < 0 {
+		skew = 0
+	}
+	// `skew` is compared as it is since doubling it might overflow.
+	if skew > (generateRangeMax-1)/2 {
+		return nil
+	}
+	u := t.step(m)
+
+	// A single HMAC state is reused for all the periods.
+	mac := t.acquireMAC()
+	defer t.releaseMAC(mac)
+	codes := make([]string, 0, 2*skew+1)
+	for i := -int64(skew); i <= int64(skew); i++ {
+		codes = append(codes, t.render(truncateWith(mac.hash, message(u+i))))
+	}
+	return codes
+}
+
+// GenerateForCounter returns a TOTP value for the time-step counter `counter`, which is T in RFC 6238 and what Counter
+// returns for a time. It is handy to reproduce the test vectors in Appendix B of RFC 6238, which list T directly.
+func (t *Token) GenerateForCounter(counter int64) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.generate(counter)
+}
+
+// GenerateHOTP returns an HOTP value defined in RFC 4226 calculated with the token's parameters and a specified
+// counter. The token's period is not used.
+func (t *Token) GenerateHOTP(counter uint64) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.generate(int64(counter))
+}
+
+// VerifyHOTP reports whether `code` matches the HOTP value for any counter from `serverCounter` to
+// `serverCounter+lookAhead`, which tolerates a client whose counter has advanced without the server noticing, e.g. by
+// codes generated but never submitted. It also returns the smallest matched counter, so the server can resynchronize
+// by storing the counter plus one as the next `serverCounter`. RFC 4226 recommends keeping `lookAhead` small.
+//
+// Every counter in the window is evaluated regardless of matches so that the time taken doesn't tell which one
+// matched. A negative `lookAhead` is treated as 0.
+func (t *Token) VerifyHOTP(code string, serverCounter uint64, lookAhead int) (matchedCounter uint64, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if utf8.RuneCountInString(code) != t.codeLength() {
+		return 0, false
+	}
+	if lookAhead < 0 {
+		lookAhead = 0
+	}
+	match := 0
+	for i := uint64(0); i <= uint64(lookAhead); i++ {
+		counter := serverCounter + i
+		// The window doesn't wrap around.
+		if counter < serverCounter {
+			break
+		}
+		m := subtle.ConstantTimeCompare([]byte(code), []byte(t.generate(int64(counter))))
+		// Only the first match is kept without branching on it.
+		mask := -uint64(m &^ match)
+		matchedCounter = matchedCounter&^mask | counter&mask
+		match |= m
+	}
+	return matchedCounter, match == 1
+}
+
+// TimeRemaining returns the time duration the TOTP for a specified time stays valid, i.e. Generate returns the same
+// value until right before `m` plus the duration and the next value from then on.
+// When `m` lands exactly on a period boundary, a new TOTP has just started and the full period is returned.
+func (t *Token) TimeRemaining(m time.Time) time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.remaining(m)
+}
+
+// IsExpiringWithin reports whether the TOTP for a specified time expires in less than `d`, as TimeRemaining tells.
+// It is handy for UIs warning users that the code is about to change.
+func (t *Token) IsExpiringWithin(m time.Time, d time.Duration) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.remaining(m) < d
+}
+
+// remaining returns the time duration the TOTP for `m` stays valid.
+func (t *Token) remaining(m time.Time) time.Duration {
+	// The fraction of a second is taken into account so that the duration ends exactly at the next boundary.
+	return t.stepStart(t.step(m) + 1).Sub(m)
+}
+
+// Counter returns the time-step counter for a specified time, i.e. `(m.Unix() - T0) / period` rounded down, which is
+// fed to HOTP to generate the TOTP value. T0 is the Unix epoch unless another one is set by WithEpoch. Consecutive
+// periods have consecutive counters, and times before T0 have negative ones.
+func (t *Token) Counter(m time.Time) int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.step(m)
+}
+
+// PeriodStart returns the time in UTC the period containing a specified time began at, i.e. `m` truncated down to a
+// multiple of the period from T0. The TOTP for `m` is valid from then on.
+func (t *Token) PeriodStart(m time.Time) time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.stepStart(t.step(m)).UTC()
+}
+
+// PeriodEnd returns the time in UTC the period containing a specified time ends at, which is the start of the next
+// period. The TOTP for `m` is valid until right before then.
+func (t *Token) PeriodEnd(m time.Time) time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.stepStart(t.step(m) + 1).UTC()
+}
+
+// NextExpiries returns the next `n` times in UTC TOTPs expire at after a specified time, i.e. the period boundaries
+// after `m` in chronological order, which lets UIs set timers to refresh codes. The first one is PeriodEnd, so it is
+// `m` plus the period when `m` lands exactly on a boundary. It returns nil when `n` is not positive or greater than
+// 10000, as GenerateRange does.
+func (t *Token) NextExpiries(m time.Time, n int) []time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if n <= 0 || n > generateRangeMax {
+		return nil
+	}
+	u := t.step(m)
+	expiries := make([]time.Time, n)
+	for i := range expiries {
+		expiries[i] = t.stepStart(u + int64(i) + 1).UTC()
+	}
+	return expiries
+}
+
+// PeriodsWithin returns the number of periods starting within the duration `d` after a specified time, i.e. how many
+// new TOTPs take over in (`m`, `m + d`]. A period starting exactly at `m` isn't counted, but one starting exactly at
+// `m + d` is. It returns 0 when `d` is not positive.
+func (t *Token) PeriodsWithin(m time.Time, d time.Duration) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if d <= 0 {
+		return 0
+	}
+	return int(t.step(m.Add(d)) - t.step(m))
+}
+
+// step returns the time-step counter for `m`.
+func (t *Token) step(m time.Time) int64 {
 	// `t.period` is guaranteed to be positive.
-	u := m.Unix() / int64(t.period)
+	p := int64(t.period)
+	elapsed := m.Unix() - t.epoch
+	u := elapsed / p
+	// Integer division truncates toward zero, so round it down for times before the epoch to keep counters monotonic.
+	if elapsed%p < 0 {
+		u--
+	}
+	return u
+}
+
+// stepStart returns the time the time step `u` starts at.
+func (t *Token) stepStart(u int64) time.Time {
+	return time.Unix(t.epoch+u*int64(t.period), 0)
+}
+
+func (t *Token) generate(u int64) string {
+	// The secret has been wiped by Destroy.
+	if len(t.secret) == 0 {
+		return ""
+	}
+	return t.render(t.truncate(u))
+}
+
+// render renders a value extracted by Dynamic Truncation as an OTP.
+func (t *Token) render(n int) string {
+	// The HMAC value was too short to be truncated.
+	if n < 0 {
+		return ""
+	}
+	if t.alphabet != "" {
+		return encodeAlphabet(n, t.alphabet, t.length)
+	}
+	// Zero-pad the value to `t.digits` like "%06d".
+	return fmt.Sprintf("%0*d", t.digits, reduce(n, t.digits))
+}
+
+func (t *Token) generateInt(u int64) uint32 {
+	// The secret has been wiped by Destroy.
+	if len(t.secret) == 0 {
+		return 0
+	}
+	n := t.truncate(u)
+	// The HMAC value was too short to be truncated.
+	if n < 0 {
+		return 0
+	}
+	return reduce(n, t.digits)
+}
+
+// HMAC returns the raw HMAC value for the time-step counter of a specified time, i.e. the value before Dynamic
+// Truncation, which is calculated with the token's secret and algorithm. It returns nil after the token has been
+// destroyed by Destroy.
+//
+// It is a low-level API for debugging and for implementing alternative truncation schemes, e.g. to check each step of
+// RFC 4226 by hand. Most users should use Generate instead.
+func (t *Token) HMAC(m time.Time) []byte {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	// The secret has been wiped by Destroy.
+	if len(t.secret) == 0 {
+		return nil
+	}
+	mac := t.acquireMAC()
+	defer t.releaseMAC(mac)
+	mac.hash.Reset()
+	mac.hash.Write(message(t.step(m)))
+	return mac.hash.Sum(nil)
+}
+
+// truncate calculates an HMAC value for the counter `u` with a cached HMAC state and returns the 31-bit integer
+// extracted from it by Dynamic Truncation.
+func (t *Token) truncate(u int64) int {
+	mac := t.acquireMAC()
+	defer t.releaseMAC(mac)
+	return truncateWith(mac.hash, message(u))
+}
+
+// acquireMAC returns an HMAC state keyed with the token's secret, which is taken from the cache if possible.
+// The caller has to hold `t.mu` and pass the state to releaseMAC once done.
+func (t *Token) acquireMAC() *cachedMAC {
+	// States cached before the secret or the algorithm changed are discarded.
+	if mac, ok := t.macs.Get().(*cachedMAC); ok && mac.generation == t.generation {
+		return mac
+	}
+	return &cachedMAC{hmac.New(t.algorithm.proc, t.secret), t.generation}
+}
+
+// releaseMAC puts an HMAC state back into the cache.
+func (t *Token) releaseMAC(mac *cachedMAC) {
+	t.macs.Put(mac)
+}
 
-	// According to RFC 4226, `msg` is a 8-byte-long bytearray.
+// codeLength returns the number of characters OTPs have.
+func (t *Token) codeLength() int {
+	if t.alphabet != "" {
+		return t.length
+	}
+	return t.digits
+}
+
+// message returns the counter `u` packed into the message HMAC is calculated with.
+func message(u int64) []byte {
+	// According to RFC 4226, `msg` is a 8-byte-long bytearray holding the counter in big-endian order.
 	// https://tools.ietf.org/html/rfc4226#section-5.1
 	msg := make([]byte, 8)
-	msg[0] = byte(u & 0x_7f_00_00_00_00_00_00_00 >> 0o70)
-	msg[1] = byte(u & 0x_00_ff_00_00_00_00_00_00 >> 0o60)
-	msg[2] = byte(u & 0x_00_00_ff_00_00_00_00_00 >> 0o50)
-	msg[3] = byte(u & 0x_00_00_00_ff_00_00_00_00 >> 0o40)
-	msg[4] = byte(u & 0x_00_00_00_00_ff_00_00_00 >> 0o30)
-	msg[5] = byte(u & 0x_00_00_00_00_00_ff_00_00 >> 0o20)
-	msg[6] = byte(u & 0x_00_00_00_00_00_00_ff_00 >> 0o10)
-	msg[7] = byte(u & 0x_00_00_00_00_00_00_00_ff >> 0o00)
+	binary.BigEndian.PutUint64(msg, uint64(u))
+	return msg
+}
+
+// steamAlphabet is the set of characters Steam Guard codes consist of.
+const steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+
+// steamLength is the number of characters a Steam Guard code has.
+const steamLength = 5
+
+// GenerateSteam returns a Steam Guard code for a specified time. Steam Guard uses the same HMAC and Dynamic
+// Truncation as TOTP, but renders the truncated value as 5 characters from its own 26-character alphabet instead of
+// decimal digits. The token's digits are not used.
+//
+// Steam Guard tokens use SHA1 and a period of 30 seconds, which are the default values of NewToken.
+func (t *Token) GenerateSteam(m time.Time) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	// The secret has been wiped by Destroy.
+	if len(t.secret) == 0 {
+		return ""
+	}
+	n := t.truncate(t.step(m))
+	// The HMAC value was too short to be truncated.
+	if n < 0 {
+		return ""
+	}
+	return encodeAlphabet(n, steamAlphabet, steamLength)
+}
 
-	return hotp(msg, t.secret, t.algorithm.proc, t.digits)
+// encodeAlphabet renders `n` as `length` characters from `alphabet`, starting from the least significant position.
+func encodeAlphabet(n int, alphabet string, length int) string {
+	chars := []rune(alphabet)
+	base := len(chars)
+	code := make([]rune, length)
+	for i := range code {
+		code[i] = chars[n%base]
+		n /= base
+	}
+	return string(code)
+}
+
+// Verify reports whether `code` matches the TOTP value for a specified time.
+// The comparison is done in constant time to avoid timing side-channels.
+// A `code` whose length differs from the token's digits is rejected without being compared.
+func (t *Token) Verify(code string, m time.Time) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if utf8.RuneCountInString(code) != t.codeLength() {
+		return false
+	}
+	otp := t.generate(t.step(m))
+	return subtle.ConstantTimeCompare([]byte(code), []byte(otp)) == 1
+}
+
+// VerifyWithSkew reports whether `code` matches the TOTP value for a specified time, tolerating clock skew between
+// the client and the server. The code is checked against the time step containing `m` as well as `skew` steps before
+// and after it, so `skew` = 1 checks 3 steps in total. A negative `skew` is treated as 0.
+//
+// Each candidate is compared in constant time. Note that every additional step widens the window an attacker can
+// guess in, so a `skew` larger than a few steps materially weakens security.
+func (t *Token) VerifyWithSkew(code string, m time.Time, skew int) bool {
+	_, ok := t.VerifyAndGetCounter(code, m, skew)
+	return ok
+}
+
+// VerifyAndGetCounter works like VerifyWithSkew but also returns the time-step counter (Counter shifted by the matched
+// step) that produced the accepted code. It returns (0, false) when nothing matched.
+//
+// Persisting the last accepted counter and rejecting any code whose counter is less than or equal to it makes each
+// code single-use, as recommended by RFC 6238.
+func (t *Token) VerifyAndGetCounter(code string, m time.Time, skew int) (int64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.verify(code, m, skew)
 }
 
-func hotp(msg []byte, secret []byte, algorithm func() hash.Hash, digits int) string {
-	// Generate an HMAC-SHA1, -SHA256, or -SHA512 value with `msg` and `secret`.
-	h := hmac.New(algorithm, secret)
+// EstimateDrift estimates how far the clock of the client that generated `code` is off, which helps to investigate
+// why a user's codes are rejected. It searches `maxSteps` periods before and after the one containing `m`, nearest
+// first, and returns the signed offset of the matched period, e.g. +30s when the client is one 30-second period
+// ahead. It returns (0, false) when nothing matched.
+//
+// The resolution is the period, so the actual drift might be off by up to one period from the returned one.
+func (t *Token) EstimateDrift(code string, m time.Time, maxSteps int) (time.Duration, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	u, ok := t.verify(code, m, maxSteps)
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(u-t.step(m)) * t.periodDuration(), true
+}
+
+// matchAll returns 1 if `code` matches the TOTP value of any step within `skew` steps of `m`, or 0 otherwise. Unlike
+// verify, it evaluates every step regardless of matches.
+func (t *Token) matchAll(code string, m time.Time, skew int) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	// The length check depends only on `code` and the token's parameters, not on whether the code matches.
+	if utf8.RuneCountInString(code) != t.codeLength() {
+		return 0
+	}
+	if skew < 0 {
+		skew = 0
+	}
+	match := 0
+	u := t.step(m)
+	for i := -int64(skew); i <= int64(skew); i++ {
+		otp := t.generate(u + i)
+		// An empty OTP, which a destroyed token or a broken hash function yields, never matches.
+		match |= subtle.ConstantTimeCompare([]byte(code), []byte(otp)) & subtle.ConstantTimeLessOrEq(1, len(otp))
+	}
+	return match
+}
+
+// verify returns the time-step counter within `skew` steps of `m` whose TOTP matches `code`.
+func (t *Token) verify(code string, m time.Time, skew int) (int64, bool) {
+	if utf8.RuneCountInString(code) != t.codeLength() {
+		return 0, false
+	}
+	if skew < 0 {
+		skew = 0
+	}
+	u := t.step(m)
+	for i := 0; i <= skew; i++ {
+		if subtle.ConstantTimeCompare([]byte(code), []byte(t.generate(u+int64(i)))) == 1 {
+			return u + int64(i), true
+		}
+		if i > 0 && subtle.ConstantTimeCompare([]byte(code), []byte(t.generate(u-int64(i)))) == 1 {
+			return u - int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// pow10 holds powers of ten up to 10^digitsLimit, where `pow10[i]` is 10^i.
+var pow10 = func() [digitsLimit + 1]int64 {
+	var p [digitsLimit + 1]int64
+	p[0] = 1
+	for i := 1; i < len(p); i++ {
+		p[i] = p[i-1] * 10
+	}
+	return p
+}()
+
+// reduce reduces a value extracted by Dynamic Truncation to `digits` decimal digits.
+func reduce(n int, digits int) uint32 {
+	// `digits` is small enough. It is guaranteed to be in the range of [DigitsMin, digitsLimit].
+	// An integer power of ten is used rather than `math.Pow10()` to avoid mixing floating-point numbers in.
+	return uint32(int64(n) % pow10[digits])
+}
+
+// macSizeMin is the minimum length of HMAC values in bytes Dynamic Truncation works with, which is the output size
+// of SHA1.
+const macSizeMin = 20
+
+// truncateWith calculates an HMAC value with `msg` and an HMAC hash `h`, which is reset before use, and returns the
+// 31-bit integer extracted from it by Dynamic Truncation. It returns -1 instead of panicking when the HMAC value is
+// shorter than `macSizeMin` bytes.
+func truncateWith(h hash.Hash, msg []byte) int {
+	h.Reset()
 	// `h.Write()` never returns an error and it's OK to ignore the return value.
 	// ref: https://pkg.go.dev/hash
 	h.Write(msg)
 	mac := h.Sum(nil)
 
+	// RegisterAlgorithm rejects hash functions with short outputs, but a broken one might still return fewer bytes than
+	// its `Size()` tells.
+	if len(mac) < macSizeMin {
+		return -1
+	}
+
 	// Start Dynamic Truncation (DT) defined in RFC 4226.
 	// https://tools.ietf.org/html/rfc4226#section-5.3
 	i := int(mac[len(mac)-1]) & 0x0f
 
-	// It is safe to naively access `mac[i+0]`...`mac[i+3]` because `i` is in the range of [0, 15] and `mac` has the
-	// result of HMAC-SHA1, -SHA256, or -SHA512, whose length is at least 20 bytes, 32 bytes, or 64 bytes respectively.
+	// It is safe to naively access `mac[i+0]`...`mac[i+3]` because `i` is in the range of [0, 15] and `mac` is at
+	// least 20 bytes long as checked above.
 	n := 0
 	n += int(mac[i+0]) & 0x7f << 0o30
 	n += int(mac[i+1]) & 0xff << 0o20
 	n += int(mac[i+2]) & 0xff << 0o10
 	n += int(mac[i+3]) & 0xff << 0o00
-
-	// `digits` is small enough. It is guaranteed to be in the range of [minDigits, maxDigits].
-	n %= int(math.Pow10(digits))
-
-	// Prepare template string like "%06d".
-	tpl := fmt.Sprintf("%%0%dd", digits)
-	return fmt.Sprintf(tpl, n)
+	return n
 }
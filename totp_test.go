@@ -1,7 +1,19 @@
 package totp
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -24,10 +36,15 @@ func TestURIValidationInNewToken(t *testing.T) {
 			ok:   false,
 		},
 		{
-			desc: "Invalid host (!= \"totp\") should be rejected",
-			uri:  "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			desc: "Invalid host (!= \"totp\" nor \"hotp\") should be rejected",
+			uri:  "otpauth://motp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
 			ok:   false,
 		},
+		{
+			desc: "Valid host (== \"hotp\") should be accepted",
+			uri:  "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=0",
+			ok:   true,
+		},
 		/* Secret */
 		{
 			desc: "Valid uppercase \"secret\" should be accepted",
@@ -54,6 +71,46 @@ func TestURIValidationInNewToken(t *testing.T) {
 			uri:  "otpauth://totp/exampleservice:exampleuser?secret=01010101010101010101010101010101",
 			ok:   false,
 		},
+		{
+			desc: "Padded \"secret\" should be accepted",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQ====",
+			ok:   true,
+		},
+		{
+			desc: "Properly padded \"secret\" should be accepted",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNA%3D",
+			ok:   true,
+		},
+		{
+			desc: "\"secret\" consisting only of padding should be rejected",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=%3D%3D%3D%3D",
+			ok:   false,
+		},
+		{
+			desc: "\"secret\" with padding in the middle should be rejected",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBV%3DGY3TQOJQ",
+			ok:   false,
+		},
+		{
+			desc: "\"secret\" grouped with spaces should be accepted",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZD%20GNBV%20GY3T%20QOJQ%20GEZD%20GNBV%20GY3T%20QOJQ",
+			ok:   true,
+		},
+		{
+			desc: "\"secret\" grouped with dashes should be accepted",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZD-GNBV-GY3T-QOJQ-GEZD-GNBV-GY3T-QOJQ",
+			ok:   true,
+		},
+		{
+			desc: "\"secret\" consisting only of separators should be rejected",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=%20-%20-",
+			ok:   false,
+		},
+		{
+			desc: "\"secret\" with invalid characters besides separators should be rejected",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZD-GNBV-GY3T-QOJ1",
+			ok:   false,
+		},
 		/* Label */
 		{
 			desc: "Empty \"label\" should be accepted",
@@ -71,6 +128,21 @@ func TestURIValidationInNewToken(t *testing.T) {
 			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice",
 			ok:   true,
 		},
+		{
+			desc: "\"issuer\" matching the label prefix should be accepted",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice",
+			ok:   true,
+		},
+		{
+			desc: "\"issuer\" not matching the label prefix should be rejected",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=otherservice",
+			ok:   false,
+		},
+		{
+			desc: "\"issuer\" with a label without prefix should be accepted",
+			uri:  "otpauth://totp/exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice",
+			ok:   true,
+		},
 		/* Algorithm */
 		{
 			desc: "Valid \"algorithm\" (== \"SHA1\") should be accepted",
@@ -87,6 +159,16 @@ func TestURIValidationInNewToken(t *testing.T) {
 			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=SHA512",
 			ok:   true,
 		},
+		{
+			desc: "Valid \"algorithm\" (== \"SHA3-256\") should be accepted",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=SHA3-256",
+			ok:   true,
+		},
+		{
+			desc: "Valid \"algorithm\" (== \"SHA3-512\") should be accepted",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=SHA3-512",
+			ok:   true,
+		},
 		{
 			desc: "Empty \"algorithm\" should be rejected",
 			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=",
@@ -133,6 +215,32 @@ func TestURIValidationInNewToken(t *testing.T) {
 			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=11",
 			ok:   false,
 		},
+		/* Counter */
+		{
+			desc: "HOTP URI without \"counter\" should be rejected",
+			uri:  "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			ok:   false,
+		},
+		{
+			desc: "Empty \"counter\" should be rejected",
+			uri:  "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=",
+			ok:   false,
+		},
+		{
+			desc: "Invalid \"counter\" (== -1) should be rejected",
+			uri:  "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=-1",
+			ok:   false,
+		},
+		{
+			desc: "Valid \"counter\" (== 18446744073709551615) should be accepted",
+			uri:  "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=18446744073709551615",
+			ok:   true,
+		},
+		{
+			desc: "TOTP URI without \"counter\" should be accepted",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			ok:   true,
+		},
 		/* Period */
 		{
 			desc: "Empty \"period\" should be rejected",
@@ -209,10 +317,14 @@ func TestDefaultValueAllocationInNewToken(t *testing.T) {
 		t.Error("\"label\" has not been set properly in NewToken()")
 	}
 
-	if tk.Issuer() != "" {
+	if tk.Issuer() != "exampleservice" {
 		t.Error("\"issuer\" has not been set properly in NewToken()")
 	}
 
+	if tk.AccountName() != "exampleuser" {
+		t.Error("Account name has not been set properly in NewToken()")
+	}
+
 	if tk.Algorithm() != "SHA1" {
 		t.Error("\"algorithm\" has not been set properly in NewToken()")
 	}
@@ -238,6 +350,8 @@ func TestGenerate(t *testing.T) {
 		{"1970-01-01T00:00:59Z", "94287082", "SHA1", 8},
 		{"1970-01-01T00:00:59Z", "32247374", "SHA256", 8},
 		{"1970-01-01T00:00:59Z", "69342147", "SHA512", 8},
+		{"1970-01-01T00:00:59Z", "09902588", "SHA3-256", 8},
+		{"1970-01-01T00:00:59Z", "04625483", "SHA3-512", 8},
 		// 2005-03-18T01:58:29Z
 		{"2005-03-18T01:58:29Z", "07081804", "SHA1", 8},
 		{"2005-03-18T01:58:29Z", "34756375", "SHA256", 8},
@@ -250,10 +364,14 @@ func TestGenerate(t *testing.T) {
 		{"2009-02-13T23:31:30Z", "89005924", "SHA1", 8},
 		{"2009-02-13T23:31:30Z", "42829826", "SHA256", 8},
 		{"2009-02-13T23:31:30Z", "76671578", "SHA512", 8},
+		{"2009-02-13T23:31:30Z", "83126551", "SHA3-256", 8},
+		{"2009-02-13T23:31:30Z", "10820341", "SHA3-512", 8},
 		// 2033-05-18T03:33:20Z
 		{"2033-05-18T03:33:20Z", "69279037", "SHA1", 8},
 		{"2033-05-18T03:33:20Z", "78428693", "SHA256", 8},
 		{"2033-05-18T03:33:20Z", "56464532", "SHA512", 8},
+		{"2033-05-18T03:33:20Z", "19495101", "SHA3-256", 8},
+		{"2033-05-18T03:33:20Z", "07158742", "SHA3-512", 8},
 		// 2603-10-11T11:33:20Z
 		{"2603-10-11T11:33:20Z", "65353130", "SHA1", 8},
 		{"2603-10-11T11:33:20Z", "24142410", "SHA256", 8},
@@ -279,3 +397,3538 @@ func TestGenerate(t *testing.T) {
 
 	}
 }
+
+func TestVerify(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+
+	cases := []struct {
+		desc string
+		code string
+		ok   bool
+	}{
+		{"Matching code should be accepted", "07081804", true},
+		{"Wrong code should be rejected", "07081805", false},
+		{"Shorter code should be rejected", "0708180", false},
+		{"Longer code should be rejected", "070818040", false},
+		{"Empty code should be rejected", "", false},
+	}
+	for _, c := range cases {
+		if ok := tk.Verify(c.code, tm); ok != c.ok {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.ok, ok)
+		}
+	}
+}
+
+func TestVerifyWithSkew(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	prev := tk.Generate(tm.Add(-30 * time.Second))
+	next := tk.Generate(tm.Add(30 * time.Second))
+	later := tk.Generate(tm.Add(60 * time.Second))
+
+	cases := []struct {
+		desc string
+		code string
+		skew int
+		ok   bool
+	}{
+		{"Current code should be accepted without skew", "07081804", 0, true},
+		{"Previous code should be rejected without skew", prev, 0, false},
+		{"Next code should be rejected without skew", next, 0, false},
+		{"Previous code should be accepted with skew 1", prev, 1, true},
+		{"Next code should be accepted with skew 1", next, 1, true},
+		{"Code two steps ahead should be rejected with skew 1", later, 1, false},
+		{"Code two steps ahead should be accepted with skew 2", later, 2, true},
+		{"Negative skew should behave like skew 0", "07081804", -1, true},
+		{"Shorter code should be rejected", "0708180", 1, false},
+	}
+	for _, c := range cases {
+		if ok := tk.VerifyWithSkew(c.code, tm, c.skew); ok != c.ok {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.ok, ok)
+		}
+	}
+}
+
+func TestVerifyAndGetCounter(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	u := tm.Unix() / 30
+
+	cases := []struct {
+		desc    string
+		code    string
+		skew    int
+		counter int64
+		ok      bool
+	}{
+		{"Current code should match the current counter", tk.Generate(tm), 1, u, true},
+		{"Previous code should match the previous counter", tk.Generate(tm.Add(-30 * time.Second)), 1, u - 1, true},
+		{"Next code should match the next counter", tk.Generate(tm.Add(30 * time.Second)), 1, u + 1, true},
+		{"Code out of the window should not match", tk.Generate(tm.Add(90 * time.Second)), 1, 0, false},
+	}
+	for _, c := range cases {
+		counter, ok := tk.VerifyAndGetCounter(c.code, tm, c.skew)
+		if counter != c.counter || ok != c.ok {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%v, %v), Actual: (%v, %v)", c.counter, c.ok, counter, ok)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	cases := []struct {
+		desc string
+		uri  string
+		want string
+	}{
+		{
+			desc: "Default parameters should be emitted explicitly",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=gezdgnbvgy3tqojqgezdgnbvgy3tqojq",
+			want: "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice&algorithm=SHA1&digits=6&period=30",
+		},
+		{
+			desc: "All parameters should be emitted",
+			uri:  "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice&algorithm=SHA512&digits=8&period=60",
+			want: "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice&algorithm=SHA512&digits=8&period=60",
+		},
+		{
+			desc: "HOTP token should emit counter instead of period",
+			uri:  "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=42",
+			want: "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice&algorithm=SHA1&digits=6&counter=42",
+		},
+		{
+			desc: "Label and issuer should be URL-encoded",
+			uri:  "otpauth://totp/Example%20%26%20Co:alice%20smith?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Example%20%26%20Co",
+			want: "otpauth://totp/Example%20&%20Co:alice%20smith?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Example%20%26%20Co&algorithm=SHA1&digits=6&period=30",
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if got := tk.String(); got != c.want {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.want, got)
+		}
+
+		// Round-trip
+		rt, err := NewToken(tk.String())
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error on round-trip: %v", err)
+			continue
+		}
+		if rt.Label() != tk.Label() || rt.Issuer() != tk.Issuer() || rt.Algorithm() != tk.Algorithm() ||
+			rt.Digits() != tk.Digits() || rt.Period() != tk.Period() || rt.String() != tk.String() {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Round-tripped token differs. Expected: %q, Actual: %q", tk.String(), rt.String())
+		}
+	}
+}
+
+func TestURIWithLabel(t *testing.T) {
+	uri := "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&issuer=corp&algorithm=SHA1&digits=6&period=30"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	cases := []struct {
+		desc     string
+		label    string
+		issuer   string
+		expected string
+	}{
+		{
+			desc:     "Label and issuer should be replaced",
+			label:    "Example: alice@corp.com",
+			issuer:   "Example",
+			expected: "otpauth://totp/Example:%20alice@corp.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&algorithm=SHA1&digits=6&period=30",
+		},
+		{
+			desc:     "Empty issuer should be omitted",
+			label:    "alice@corp.com",
+			issuer:   "",
+			expected: "otpauth://totp/alice@corp.com?secret=JBSWY3DPEHPK3PXP&algorithm=SHA1&digits=6&period=30",
+		},
+	}
+	for _, c := range cases {
+		actual := tk.URIWithLabel(c.label, c.issuer)
+		if actual != c.expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.expected, actual)
+		}
+		other, err := NewToken(actual)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if other.Label() != c.label || other.Issuer() != c.issuer {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%q, %q), Actual: (%q, %q)", c.label, c.issuer, other.Label(), other.Issuer())
+		}
+	}
+
+	// The token itself is kept as it is.
+	if tk.String() != uri {
+		t.Errorf("Expected: %q, Actual: %q", uri, tk.String())
+	}
+}
+
+func TestNewTokenFromParams(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	cases := []struct {
+		desc string
+		opts []Option
+		ok   bool
+	}{
+		{"No options should be accepted", nil, true},
+		{"Valid \"algorithm\" should be accepted", []Option{WithAlgorithm("SHA256")}, true},
+		{"Invalid \"algorithm\" should be rejected", []Option{WithAlgorithm("MD5")}, false},
+		{"Valid \"digits\" (== 8) should be accepted", []Option{WithDigits(8)}, true},
+		{"Invalid \"digits\" (== 5) should be rejected", []Option{WithDigits(5)}, false},
+		{"Invalid \"digits\" (== 11) should be rejected", []Option{WithDigits(11)}, false},
+		{"\"digits\" (== 11) should be accepted with max digits 12", []Option{WithMaxDigits(12), WithDigits(11)}, true},
+		{"\"digits\" (== 11) should be accepted regardless of the order", []Option{WithDigits(11), WithMaxDigits(12)}, true},
+		{"\"digits\" (== 10) should be rejected with max digits 8", []Option{WithMaxDigits(8), WithDigits(10)}, false},
+		{"Max digits (== 5) should be rejected", []Option{WithMaxDigits(5)}, false},
+		{"Max digits (== 19) should be rejected", []Option{WithMaxDigits(19)}, false},
+		{"Valid \"period\" (== 60) should be accepted", []Option{WithPeriod(60)}, true},
+		{"Invalid \"period\" (== 0) should be rejected", []Option{WithPeriod(0)}, false},
+		{"Invalid \"period\" (== 91) should be rejected", []Option{WithPeriod(91)}, false},
+		{"Valid \"period\" (== 1m) should be accepted", []Option{WithPeriodDuration(time.Minute)}, true},
+		{"Invalid \"period\" (== 1500ms) should be rejected", []Option{WithPeriodDuration(1500 * time.Millisecond)}, false},
+		{"Invalid \"period\" (== 500ms) should be rejected", []Option{WithPeriodDuration(500 * time.Millisecond)}, false},
+		{"Invalid \"period\" (== 91s) should be rejected", []Option{WithPeriodDuration(91 * time.Second)}, false},
+	}
+	for _, c := range cases {
+		_, err := NewTokenFromParams(secret, c.opts...)
+		if c.ok && err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Error("Expected an error but didn't get one")
+		}
+	}
+
+	if _, err := NewTokenFromParams(nil); err == nil {
+		t.Error("Expected an error for an empty secret but didn't get one")
+	}
+
+	// The token should generate the same OTPs as the one parsed from the equivalent URI.
+	tk, err := NewTokenFromParams(secret, WithAlgorithm("SHA1"), WithDigits(8))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	if otp := tk.Generate(tm); otp != "07081804" {
+		t.Errorf("OTP didn't match. Expected: %q, Actual: %q", "07081804", otp)
+	}
+
+	// Modifying the passed secret shouldn't affect the token.
+	secret[0] = 0
+	if otp := tk.Generate(tm); otp != "07081804" {
+		t.Errorf("OTP changed after modifying the passed secret. Expected: %q, Actual: %q", "07081804", otp)
+	}
+}
+
+func TestNewTokenFromValues(t *testing.T) {
+	values := url.Values{
+		"secret":    {"JBSWY3DPEHPK3PXP"},
+		"issuer":    {"Example"},
+		"algorithm": {"SHA256"},
+		"digits":    {"8"},
+		"period":    {"60"},
+		"color":     {"blue"},
+	}
+	tk, err := NewTokenFromValues("Example:alice@google.com", values)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	expected, err := NewToken("otpauth://totp/Example:alice@google.com?" + values.Encode())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if tk.String() != expected.String() {
+		t.Errorf("Expected: %q, Actual: %q", expected.String(), tk.String())
+	}
+	// Modifying the values afterward doesn't affect the token.
+	values["color"][0] = "red"
+	if tk.String() != expected.String() {
+		t.Errorf("Expected: %q, Actual: %q", expected.String(), tk.String())
+	}
+
+	cases := []struct {
+		desc   string
+		label  string
+		values url.Values
+		opts   []Option
+		field  string
+		err    error
+	}{
+		{
+			desc:   "Missing secret should be rejected",
+			label:  "alice@google.com",
+			values: url.Values{"issuer": {"Example"}},
+			field:  "secret",
+			err:    ErrMissingSecret,
+		},
+		{
+			desc:   "Digits out of range should be rejected",
+			label:  "alice@google.com",
+			values: url.Values{"secret": {"JBSWY3DPEHPK3PXP"}, "digits": {"11"}},
+			field:  "digits",
+			err:    ErrDigitsOutOfRange,
+		},
+		{
+			desc:   "Issuer mismatch should be rejected",
+			label:  "Example:alice@google.com",
+			values: url.Values{"secret": {"JBSWY3DPEHPK3PXP"}, "issuer": {"Other"}},
+			field:  "issuer",
+			err:    ErrIssuerMismatch,
+		},
+		{
+			desc:   "Counter should be rejected",
+			label:  "alice@google.com",
+			values: url.Values{"secret": {"JBSWY3DPEHPK3PXP"}, "counter": {"3"}},
+			field:  "counter",
+			err:    ErrInvalidCounter,
+		},
+		{
+			desc:   "Unknown parameter should be rejected in strict mode",
+			label:  "alice@google.com",
+			values: url.Values{"secret": {"JBSWY3DPEHPK3PXP"}, "color": {"blue"}},
+			opts:   []Option{WithStrictParams()},
+			field:  "color",
+			err:    ErrUnknownParameter,
+		},
+	}
+	for _, c := range cases {
+		_, err := NewTokenFromValues(c.label, c.values, c.opts...)
+		var pe *ParseError
+		if !errors.Is(err, c.err) || !errors.As(err, &pe) || pe.Field != c.field {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v on %q, Actual: %v", c.err, c.field, err)
+			continue
+		}
+		// There's no URI to tell.
+		if pe.URI != "" || strings.Contains(err.Error(), "URI: ") {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Error should not mention URI. Got %v", err)
+		}
+	}
+}
+
+func TestOptionsInNewTokenFromParams(t *testing.T) {
+	tk, err := NewTokenFromParams(
+		[]byte("12345678901234567890"),
+		WithLabel("exampleservice:exampleuser"),
+		WithIssuer("exampleservice"),
+		WithAlgorithm("SHA512"),
+		WithDigits(8),
+		WithPeriod(60),
+	)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if tk.Label() != "exampleservice:exampleuser" {
+		t.Error("\"label\" has not been set properly in NewTokenFromParams()")
+	}
+
+	if tk.Issuer() != "exampleservice" {
+		t.Error("\"issuer\" has not been set properly in NewTokenFromParams()")
+	}
+
+	if tk.Algorithm() != "SHA512" {
+		t.Error("\"algorithm\" has not been set properly in NewTokenFromParams()")
+	}
+
+	if tk.Digits() != 8 {
+		t.Error("\"digits\" has not been set properly in NewTokenFromParams()")
+	}
+
+	if tk.Period() != 60 {
+		t.Error("\"period\" has not been set properly in NewTokenFromParams()")
+	}
+
+	if tk.PeriodDuration() != time.Minute {
+		t.Error("\"period\" has not been set properly in NewTokenFromParams()")
+	}
+}
+
+func TestTimeRemaining(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		time      string
+		remaining time.Duration
+	}{
+		{"2005-03-18T01:58:00Z", 30 * time.Second},
+		{"2005-03-18T01:58:01Z", 29 * time.Second},
+		{"2005-03-18T01:58:29Z", 1 * time.Second},
+		{"2005-03-18T01:58:30Z", 30 * time.Second},
+		{"2005-03-18T01:58:31Z", 29 * time.Second},
+		{"2005-03-18T01:58:29.75Z", 250 * time.Millisecond},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		if remaining := tk.TimeRemaining(tm); remaining != c.remaining {
+			t.Errorf("Remaining time didn't match for %v. Expected: %v, Actual: %v", c.time, c.remaining, remaining)
+		}
+	}
+}
+
+func TestPeriodBoundary(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	cases := []struct {
+		desc string
+		time string
+		opts []Option
+	}{
+		{desc: "Time on a boundary", time: "2005-03-18T01:58:30Z"},
+		{desc: "Time right after a boundary", time: "2005-03-18T01:58:30.000000001Z"},
+		{desc: "Time right before a boundary", time: "2005-03-18T01:58:29.999999999Z"},
+		{desc: "Time on a boundary before the Unix epoch", time: "1969-12-31T23:59:30Z"},
+		{desc: "Time in the middle of a period before the Unix epoch", time: "1969-12-31T23:59:29.5Z"},
+		{
+			desc: "Time on a boundary with a custom epoch",
+			time: "2005-03-18T01:58:40Z",
+			opts: []Option{WithEpoch(time.Unix(10, 0))},
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(uri, c.opts...)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+
+		remaining := tk.TimeRemaining(tm)
+		if remaining <= 0 || remaining > tk.PeriodDuration() {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Remaining time have to be in the range of (0, %v]. Got %v", tk.PeriodDuration(), remaining)
+		}
+		if tm.Equal(tk.PeriodStart(tm)) && remaining != tk.PeriodDuration() {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", tk.PeriodDuration(), remaining)
+		}
+		if end := tm.Add(remaining); !end.Equal(tk.PeriodEnd(tm)) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", tk.PeriodEnd(tm), end)
+		}
+		// The TOTP stays the same until right before the end of the remaining time and changes then.
+		if actual := tk.Generate(tm.Add(remaining - time.Nanosecond)); actual != tk.Generate(tm) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", tk.Generate(tm), actual)
+		}
+		if tk.Counter(tm.Add(remaining)) != tk.Counter(tm)+1 {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", tk.Counter(tm)+1, tk.Counter(tm.Add(remaining)))
+		}
+	}
+}
+
+func TestGenerateIgnoresLocationAndSubSeconds(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	base, err := time.Parse(time.RFC3339, "2005-03-18T01:58:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	cases := []struct {
+		desc string
+		time time.Time
+	}{
+		{"Time in UTC", base},
+		{"Same instant in a positive offset", base.In(time.FixedZone("JST", 9*60*60))},
+		{"Same instant in a negative offset", base.In(time.FixedZone("PST", -8*60*60))},
+		{"Same instant in a half-hour offset", base.In(time.FixedZone("IST", 5*60*60+30*60))},
+		{"Same instant in the local time zone", base.Local()},
+		{"Instant with nanoseconds", base.Add(time.Nanosecond)},
+		{"Instant with milliseconds in another location", base.Add(500 * time.Millisecond).In(time.FixedZone("JST", 9*60*60))},
+		{"Instant right before the next period", base.Add(30*time.Second - time.Nanosecond)},
+	}
+	for _, c := range cases {
+		if otp := tk.Generate(c.time); otp != "14050471" {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", "14050471", otp)
+		}
+	}
+
+	// A time with a monotonic clock reading yields the same OTP as the one without.
+	now := time.Now()
+	if tk.Generate(now) != tk.Generate(now.Round(0).UTC()) {
+		t.Errorf("Expected: %q, Actual: %q", tk.Generate(now.Round(0).UTC()), tk.Generate(now))
+	}
+}
+
+func TestGenerateWithExpiry(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		time      string
+		otp       string
+		expiresAt string
+	}{
+		{"2005-03-18T01:58:29Z", "07081804", "2005-03-18T01:58:30Z"},
+		{"2005-03-18T01:58:30Z", "14050471", "2005-03-18T01:59:00Z"},
+		{"2005-03-18T01:58:31Z", "14050471", "2005-03-18T01:59:00Z"},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		expiresAt, err := time.Parse(time.RFC3339, c.expiresAt)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.expiresAt)
+		}
+
+		otp, exp := tk.GenerateWithExpiry(tm)
+		if otp != c.otp {
+			t.Errorf("OTP didn't match for %v. Expected: %q, Actual: %q", c.time, c.otp, otp)
+		}
+		if !exp.Equal(expiresAt) {
+			t.Errorf("Expiry didn't match for %v. Expected: %v, Actual: %v", c.time, expiresAt, exp)
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	cases := []struct {
+		desc     string
+		uri      string
+		expected string
+	}{
+		{
+			desc:     "TOTP URI should be of type totp",
+			uri:      "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			expected: "totp",
+		},
+		{
+			desc:     "HOTP URI should be of type hotp",
+			uri:      "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=0",
+			expected: "hotp",
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if actual := tk.Type(); actual != c.expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.expected, actual)
+		}
+	}
+
+	tk, err := NewTokenFromParams([]byte("12345678901234567890"))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if actual := tk.Type(); actual != "totp" {
+		t.Errorf("Expected: %q, Actual: %q", "totp", actual)
+	}
+}
+
+func TestCandidateCodes(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	cases := []struct {
+		desc     string
+		skew     int
+		expected []string
+	}{
+		{
+			desc:     "Zero skew should return the current code only",
+			skew:     0,
+			expected: []string{"14050471"},
+		},
+		{
+			desc:     "Negative skew should be treated as zero",
+			skew:     -1,
+			expected: []string{"14050471"},
+		},
+		{
+			desc: "Codes should be in chronological order",
+			skew: 1,
+			expected: []string{
+				tk.Generate(tm.Add(-30 * time.Second)),
+				"14050471",
+				tk.Generate(tm.Add(30 * time.Second)),
+			},
+		},
+		{
+			desc:     "Too large skew should return nothing",
+			skew:     5000,
+			expected: nil,
+		},
+		{
+			desc:     "Maximum int skew should return nothing",
+			skew:     math.MaxInt,
+			expected: nil,
+		},
+	}
+	for _, c := range cases {
+		actual := tk.CandidateCodes(tm, c.skew)
+		if strings.Join(actual, ",") != strings.Join(c.expected, ",") {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.expected, actual)
+		}
+		// Every candidate is accepted by VerifyWithSkew.
+		for _, code := range actual {
+			if !tk.VerifyWithSkew(code, tm, c.skew) {
+				t.Errorf("[CASE] %v", c.desc)
+				t.Errorf("Candidate %q should be accepted", code)
+			}
+		}
+	}
+	if expected := "07081804"; tk.CandidateCodes(tm, 1)[0] != expected {
+		t.Errorf("Expected: %q, Actual: %q", expected, tk.CandidateCodes(tm, 1)[0])
+	}
+}
+
+func TestGenerateForCounter(t *testing.T) {
+	tk, err := NewTokenFromSecretHex("3132333435363738393031323334353637383930", WithDigits(8))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	// The values of T and TOTP in Appendix B of RFC 6238.
+	cases := []struct {
+		counter int64
+		otp     string
+	}{
+		{0x0000000000000001, "94287082"},
+		{0x00000000023523EC, "07081804"},
+		{0x00000000023523ED, "14050471"},
+		{0x000000000273EF07, "89005924"},
+		{0x0000000003F940AA, "69279037"},
+		{0x0000000027BC86AA, "65353130"},
+	}
+	for _, c := range cases {
+		if otp := tk.GenerateForCounter(c.counter); otp != c.otp {
+			t.Errorf("OTP didn't match for T = %016X. Expected: %q, Actual: %q", c.counter, c.otp, otp)
+		}
+	}
+
+	// The counter for a time yields the same TOTP as the time.
+	tm, err := time.Parse(time.RFC3339, "2033-05-18T03:33:20Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	if tk.GenerateForCounter(tk.Counter(tm)) != tk.Generate(tm) {
+		t.Errorf("Expected: %q, Actual: %q", tk.Generate(tm), tk.GenerateForCounter(tk.Counter(tm)))
+	}
+}
+
+func TestGenerateHOTP(t *testing.T) {
+	// Test vectors from RFC 4226 Appendix D.
+	uri := "otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=5"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if tk.InitialCounter() != 5 {
+		t.Errorf("\"counter\" has not been set properly in NewToken(). Expected: %v, Actual: %v", 5, tk.InitialCounter())
+	}
+
+	otps := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for i, expected := range otps {
+		if otp := tk.GenerateHOTP(uint64(i)); otp != expected {
+			t.Errorf("OTP didn't match for counter %v. Expected: %q, Actual: %q", i, expected, otp)
+		}
+	}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestNow(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+
+	tk.WithClock(fixedClock(tm))
+	if otp := tk.Now(); otp != "07081804" {
+		t.Errorf("OTP didn't match with a fixed clock. Expected: %q, Actual: %q", "07081804", otp)
+	}
+
+	// The default clock should be restored with nil.
+	tk.WithClock(nil)
+	if otp := tk.Now(); len(otp) != 8 {
+		t.Errorf("Unexpected OTP with the default clock: %q", otp)
+	}
+}
+
+func TestNewTokenFromSecretHex(t *testing.T) {
+	// Test vectors from RFC 6238 Appendix B. Each algorithm uses a seed of its own output length.
+	seeds := map[string]string{
+		"SHA1":   "3132333435363738393031323334353637383930",
+		"SHA256": "3132333435363738393031323334353637383930313233343536373839303132",
+		"SHA512": "31323334353637383930313233343536373839303132333435363738393031323334353637383930313233343536373839303132333435363738393031323334",
+	}
+	cases := []struct {
+		time      string
+		otp       string
+		algorithm string
+	}{
+		{"1970-01-01T00:00:59Z", "94287082", "SHA1"},
+		{"1970-01-01T00:00:59Z", "46119246", "SHA256"},
+		{"1970-01-01T00:00:59Z", "90693936", "SHA512"},
+		{"2009-02-13T23:31:30Z", "89005924", "SHA1"},
+		{"2009-02-13T23:31:30Z", "91819424", "SHA256"},
+		{"2009-02-13T23:31:30Z", "93441116", "SHA512"},
+		{"2603-10-11T11:33:20Z", "65353130", "SHA1"},
+		{"2603-10-11T11:33:20Z", "77737706", "SHA256"},
+		{"2603-10-11T11:33:20Z", "47863826", "SHA512"},
+		// Extreme future times beyond RFC 6238, cross-checked against Python's hmac module.
+		{"3000-01-01T00:00:00Z", "33692314", "SHA1"},
+		{"3000-01-01T00:00:00Z", "09495543", "SHA256"},
+		{"3000-01-01T00:00:00Z", "28922935", "SHA512"},
+		{"9999-12-31T23:59:59Z", "60099568", "SHA1"},
+		{"9999-12-31T23:59:59Z", "58300069", "SHA256"},
+		{"9999-12-31T23:59:59Z", "82458292", "SHA512"},
+	}
+	for i, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+
+		tk, err := NewTokenFromSecretHex(seeds[c.algorithm], WithAlgorithm(c.algorithm), WithDigits(8))
+		if err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+
+		if otp := tk.Generate(tm); otp != c.otp {
+			t.Errorf("OTP didn't match for testcase #%v. Expected: %q, Actual: %q", i+1, c.otp, otp)
+		}
+	}
+
+	for _, s := range []string{"", "0", "zz"} {
+		if _, err := NewTokenFromSecretHex(s); err == nil {
+			t.Errorf("Expected an error for hex secret %q but didn't get one", s)
+		}
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tk, err := NewTokenFromParams(secret, WithDigits(8))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+
+	internal := tk.secret
+	tk.Destroy()
+
+	for i, b := range internal {
+		if b != 0 {
+			t.Errorf("Secret byte #%v has not been wiped: %v", i, b)
+		}
+	}
+
+	if otp := tk.Generate(tm); otp != "" {
+		t.Errorf("Destroyed token generated an OTP: %q", otp)
+	}
+
+	if tk.Verify("07081804", tm) {
+		t.Error("Destroyed token verified an OTP")
+	}
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=exampleservice&algorithm=SHA256&digits=8&period=60"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	text, err := tk.MarshalText()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if string(text) != uri {
+		t.Errorf("Text didn't match. Expected: %q, Actual: %q", uri, text)
+	}
+
+	var rt Token
+	if err := rt.UnmarshalText(text); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if rt.String() != tk.String() {
+		t.Errorf("Round-tripped token differs. Expected: %q, Actual: %q", tk.String(), rt.String())
+	}
+
+	if err := rt.UnmarshalText([]byte("http://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")); err == nil {
+		t.Error("Expected an error but didn't get one")
+	}
+}
+
+func TestTextRoundTripWithMismatchedIssuer(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	built, err := NewTokenFromParams(secret, WithLabel("Foo:bob"), WithIssuer("Bar"))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	lenient, err := NewToken("otpauth://totp/Foo:bob?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Bar", WithLenientIssuer())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	reissued, err := NewToken("otpauth://totp/Foo:bob?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Foo")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	reissued.SetIssuer("Bar")
+
+	cases := []struct {
+		desc  string
+		token *Token
+	}{
+		{"Token built with a mismatched issuer should round-trip", built},
+		{"Token parsed with WithLenientIssuer should round-trip", lenient},
+		{"Token whose issuer was changed by SetIssuer should round-trip", reissued},
+	}
+	for _, c := range cases {
+		text, err := c.token.MarshalText()
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		var rt Token
+		if err := rt.UnmarshalText(text); err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if !rt.Equal(c.token) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.token.String(), rt.String())
+		}
+	}
+}
+
+func TestMarshalTextUnrepresentable(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	cases := []struct {
+		desc string
+		opts []Option
+	}{
+		{"Token with an epoch should be rejected", []Option{WithEpoch(time.Unix(1000, 0))}},
+		{"Token with an alphabet should be rejected", []Option{WithAlphabet(steamAlphabet, steamLength)}},
+	}
+	for _, c := range cases {
+		tk, err := NewTokenFromParams(secret, c.opts...)
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		if text, err := tk.MarshalText(); err == nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected an error but got %q", text)
+		}
+	}
+}
+
+func TestSecretBase32(t *testing.T) {
+	cases := []struct {
+		uri    string
+		secret string
+	}{
+		{"otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"},
+		{"otpauth://totp/exampleservice:exampleuser?secret=gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"},
+		{"otpauth://totp/exampleservice:exampleuser?secret=GEZDGNA%3D", "GEZDGNA"},
+		{"otpauth://totp/exampleservice:exampleuser?secret=gezd+gnbv-gy3t%20qojq", "GEZDGNBVGY3TQOJQ"},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri)
+		if err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if secret := tk.SecretBase32(); secret != c.secret {
+			t.Errorf("Secret didn't match for %q. Expected: %q, Actual: %q", c.uri, c.secret, secret)
+		}
+	}
+}
+
+func TestSecretBytes(t *testing.T) {
+	tk, err := NewTokenFromParams([]byte("12345678901234567890"))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	secret := tk.SecretBytes()
+	if string(secret) != "12345678901234567890" {
+		t.Errorf("Secret didn't match. Expected: %q, Actual: %q", "12345678901234567890", secret)
+	}
+
+	// Modifying the returned slice shouldn't affect the token.
+	secret[0] = 0
+	if string(tk.SecretBytes()) != "12345678901234567890" {
+		t.Error("Modifying the returned secret affected the token")
+	}
+}
+
+func TestIssuerAndAccountNameInNewToken(t *testing.T) {
+	cases := []struct {
+		desc    string
+		uri     string
+		opts    []Option
+		issuer  string
+		account string
+	}{
+		{
+			desc:    "Issuer should be taken from the label prefix",
+			uri:     "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP",
+			issuer:  "Example",
+			account: "alice@google.com",
+		},
+		{
+			desc:    "URL-encoded colon should separate the issuer",
+			uri:     "otpauth://totp/Example%3Aalice@google.com?secret=JBSWY3DPEHPK3PXP",
+			issuer:  "Example",
+			account: "alice@google.com",
+		},
+		{
+			desc:    "Spaces after the colon should be removed from the account name",
+			uri:     "otpauth://totp/Example:%20%20alice@google.com?secret=JBSWY3DPEHPK3PXP",
+			issuer:  "Example",
+			account: "alice@google.com",
+		},
+		{
+			desc:    "Issuer query parameter should take precedence over the label prefix in lenient mode",
+			uri:     "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Other",
+			opts:    []Option{WithLenientIssuer()},
+			issuer:  "Other",
+			account: "alice@google.com",
+		},
+		{
+			desc:    "Label without a colon should be the account name",
+			uri:     "otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP",
+			issuer:  "",
+			account: "alice@google.com",
+		},
+		{
+			desc:    "Only the first colon should separate the issuer",
+			uri:     "otpauth://totp/Example:alice:bob?secret=JBSWY3DPEHPK3PXP",
+			issuer:  "Example",
+			account: "alice:bob",
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri, c.opts...)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if tk.Issuer() != c.issuer || tk.AccountName() != c.account {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%q, %q), Actual: (%q, %q)", c.issuer, c.account, tk.Issuer(), tk.AccountName())
+		}
+	}
+}
+
+func TestLabelWithoutAccountName(t *testing.T) {
+	cases := []struct {
+		desc   string
+		uri    string
+		issuer string
+	}{
+		{
+			desc:   "Label with a trailing colon should be the issuer",
+			uri:    "otpauth://totp/Example:?secret=JBSWY3DPEHPK3PXP",
+			issuer: "Example",
+		},
+		{
+			desc:   "Label with a trailing colon and spaces should be the issuer",
+			uri:    "otpauth://totp/Example:%20?secret=JBSWY3DPEHPK3PXP",
+			issuer: "Example",
+		},
+		{
+			desc:   "Label with a trailing colon should agree with the issuer query parameter",
+			uri:    "otpauth://totp/Example:?secret=JBSWY3DPEHPK3PXP&issuer=Example",
+			issuer: "Example",
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if tk.Label() != "" || tk.Issuer() != c.issuer || tk.AccountName() != "" {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%q, %q, %q), Actual: (%q, %q, %q)", "", c.issuer, "", tk.Label(), tk.Issuer(), tk.AccountName())
+		}
+		expected := "otpauth://totp/?secret=JBSWY3DPEHPK3PXP&issuer=" + c.issuer + "&algorithm=SHA1&digits=6&period=30"
+		if tk.String() != expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", expected, tk.String())
+		}
+	}
+
+	if _, err := NewToken("otpauth://totp/Example:?secret=JBSWY3DPEHPK3PXP&issuer=Other"); !errors.Is(err, ErrIssuerMismatch) {
+		t.Errorf("Expected: %v, Actual: %v", ErrIssuerMismatch, err)
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	cases := []struct {
+		desc     string
+		name     string
+		expected Algorithm
+		ok       bool
+	}{
+		{"Canonical name should be parsed", "SHA256", AlgorithmSHA256, true},
+		{"Lowercase name should be parsed", "sha3-512", AlgorithmSHA3512, true},
+		{"Unknown name should be rejected", "MD5", "", false},
+		{"Empty name should be rejected", "", "", false},
+	}
+	for _, c := range cases {
+		actual, err := ParseAlgorithm(c.name)
+		if c.ok && err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if !c.ok && !errors.Is(err, ErrInvalidAlgorithm) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", ErrInvalidAlgorithm, err)
+			continue
+		}
+		if actual != c.expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.expected, actual)
+		}
+	}
+
+	// The algorithm can be passed to WithAlgorithm and is returned by TypedAlgorithm.
+	tk, err := NewTokenFromParams([]byte("12345678901234567890"), WithAlgorithm(AlgorithmSHA512.String()))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if tk.TypedAlgorithm() != AlgorithmSHA512 || tk.Algorithm() != "SHA512" {
+		t.Errorf("Expected: (%q, %q), Actual: (%q, %q)", AlgorithmSHA512, "SHA512", tk.TypedAlgorithm(), tk.Algorithm())
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	cases := []struct {
+		desc     string
+		uri      string
+		opts     []Option
+		warnings int
+	}{
+		{
+			desc:     "Standard settings should have no warning",
+			uri:      "otpauth://totp/alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			warnings: 0,
+		},
+		{
+			desc:     "8 digits should have no warning",
+			uri:      "otpauth://totp/alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8",
+			warnings: 0,
+		},
+		{
+			desc:     "7 digits should be warned",
+			uri:      "otpauth://totp/alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=7",
+			warnings: 1,
+		},
+		{
+			desc:     "Period of 45 seconds should be warned",
+			uri:      "otpauth://totp/alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&period=45",
+			warnings: 1,
+		},
+		{
+			desc:     "Period of HOTP should not be warned",
+			uri:      "otpauth://hotp/alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=0&period=45",
+			warnings: 0,
+		},
+		{
+			desc:     "SHA256 should be warned",
+			uri:      "otpauth://totp/alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=SHA256",
+			warnings: 1,
+		},
+		{
+			desc:     "SHA3-256 should be warned",
+			uri:      "otpauth://totp/alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=SHA3-256",
+			warnings: 1,
+		},
+		{
+			desc:     "Short secret should be warned",
+			uri:      "otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP",
+			warnings: 1,
+		},
+		{
+			desc:     "Custom alphabet should be warned",
+			uri:      "otpauth://totp/alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			opts:     []Option{WithAlphabet("23456789BCDFGHJKMNPQRTVWXY", 5)},
+			warnings: 1,
+		},
+		{
+			desc:     "Every unusual setting should be warned",
+			uri:      "otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&digits=7&period=45&algorithm=SHA512",
+			warnings: 4,
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri, c.opts...)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if warnings := tk.Warnings(); len(warnings) != c.warnings {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected %v warnings. Got %q", c.warnings, warnings)
+		}
+	}
+}
+
+func TestRegisterAlgorithm(t *testing.T) {
+	if err := RegisterAlgorithm("SHA384", sha512.New384); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		desc string
+		name string
+		fn   func() hash.Hash
+	}{
+		{"Built-in name should be rejected", "SHA1", sha512.New384},
+		{"Already registered name should be rejected", "SHA384", sha512.New384},
+		{"Empty name should be rejected", "", sha512.New384},
+		{"Nil hash function should be rejected", "SHA512/256", nil},
+	}
+	for _, c := range cases {
+		if err := RegisterAlgorithm(c.name, c.fn); err == nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Error("Expected an error but didn't get one")
+		}
+	}
+
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=SHA384&digits=8"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if tk.Algorithm() != "SHA384" {
+		t.Errorf("\"algorithm\" has not been set properly in NewToken(). Expected: %q, Actual: %q", "SHA384", tk.Algorithm())
+	}
+
+	// The registered hash function should be used to generate OTPs.
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	if otp := tk.Generate(tm); otp != "53863051" {
+		t.Errorf("OTP didn't match. Expected: %q, Actual: %q", "53863051", otp)
+	}
+}
+
+func TestGenerateSteam(t *testing.T) {
+	tk, err := NewTokenFromParams([]byte("12345678901234567890"))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		time string
+		code string
+	}{
+		{"1970-01-01T00:00:59Z", "PV9M4"},
+		{"2005-03-18T01:58:29Z", "PY4YB"},
+		{"2009-02-13T23:31:30Z", "VHHQY"},
+		{"2033-05-18T03:33:20Z", "9N776"},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		if code := tk.GenerateSteam(tm); code != c.code {
+			t.Errorf("Steam Guard code didn't match for %v. Expected: %q, Actual: %q", c.time, c.code, code)
+		}
+	}
+}
+
+func TestWithAlphabet(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	cases := []struct {
+		desc     string
+		alphabet string
+		length   int
+		ok       bool
+	}{
+		{"Valid alphabet should be accepted", "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ", 7, true},
+		{"Binary alphabet should be accepted", "01", 31, true},
+		{"Non-ASCII alphabet should be accepted", "αβγδ", 8, true},
+		{"Empty alphabet should be rejected", "", 6, false},
+		{"Single-character alphabet should be rejected", "0", 6, false},
+		{"Alphabet with duplicates should be rejected", "0112", 6, false},
+		{"Zero length should be rejected", "0123456789", 0, false},
+		{"Length of 32 should be rejected", "01", 32, false},
+		{"Huge length should be rejected", "ab", math.MaxInt32, false},
+	}
+	for _, c := range cases {
+		_, err := NewTokenFromParams(secret, WithAlphabet(c.alphabet, c.length))
+		if c.ok && err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Error("Expected an error but didn't get one")
+		}
+	}
+
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+
+	// The Steam Guard alphabet should reproduce GenerateSteam.
+	steam, err := NewTokenFromParams(secret, WithAlphabet(steamAlphabet, steamLength))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if code := steam.Generate(tm); code != steam.GenerateSteam(tm) {
+		t.Errorf("Code didn't match GenerateSteam(). Expected: %q, Actual: %q", steam.GenerateSteam(tm), code)
+	}
+	if !steam.Verify(steam.Generate(tm), tm) {
+		t.Error("Generated code with a custom alphabet has not been verified")
+	}
+
+	// A decimal alphabet should render the same digits as the default rendering in reverse order, since the alphabet
+	// rendering starts from the least significant position.
+	decimal, err := NewTokenFromParams(secret, WithAlphabet("0123456789", 8))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if code := decimal.Generate(tm); code != "42950098" {
+		t.Errorf("Code didn't match. Expected: %q, Actual: %q", "42950098", code)
+	}
+}
+
+func TestMaxDigitsInNewToken(t *testing.T) {
+	uriTpl := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=%v"
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+
+	if _, err := NewToken(fmt.Sprintf(uriTpl, 11)); err == nil {
+		t.Error("Expected an error for digits 11 without max digits but didn't get one")
+	}
+
+	// Digits beyond the 31-bit truncated value should be zero-padded.
+	cases := []struct {
+		digits int
+		otp    string
+	}{
+		{10, "0689005924"},
+		{12, "000689005924"},
+		{18, "000000000689005924"},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(fmt.Sprintf(uriTpl, c.digits), WithMaxDigits(18))
+		if err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if otp := tk.Generate(tm); otp != c.otp {
+			t.Errorf("OTP didn't match for digits %v. Expected: %q, Actual: %q", c.digits, c.otp, otp)
+		}
+	}
+}
+
+func TestMaxDigitsRoundTrip(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tk, err := NewTokenFromParams(secret, WithMaxDigits(12), WithDigits(12))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if err := tk.SetDigits(11); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	if err := tk.SetDigits(13); !errors.Is(err, ErrDigitsOutOfRange) {
+		t.Errorf("Expected: %v, Actual: %v", ErrDigitsOutOfRange, err)
+	}
+
+	// The restored tokens admit their own digits, but no more than that.
+	data, err := tk.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	var fromJSON Token
+	if err := fromJSON.UnmarshalJSON(data); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	text, err := tk.MarshalText()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	var fromText Token
+	if err := fromText.UnmarshalText(text); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	for _, rt := range []*Token{&fromJSON, &fromText} {
+		if !rt.Equal(tk) {
+			t.Errorf("Round-tripped token differs. Expected: %q, Actual: %q", tk.String(), rt.String())
+		}
+		if err := rt.SetDigits(10); err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+		}
+		if err := rt.SetDigits(11); err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+		}
+		if err := rt.SetDigits(12); !errors.Is(err, ErrDigitsOutOfRange) {
+			t.Errorf("Expected: %v, Actual: %v", ErrDigitsOutOfRange, err)
+		}
+	}
+
+	if _, err := NewToken(tk.String(), WithMaxDigits(12)); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+}
+
+func TestWithMinDigits(t *testing.T) {
+	cases := []struct {
+		desc string
+		uri  string
+		opts []Option
+		err  error
+		ok   bool
+	}{
+		{
+			desc: "Digits above the minimum should be accepted",
+			uri:  "otpauth://totp/exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8",
+			opts: []Option{WithMinDigits(8)},
+			ok:   true,
+		},
+		{
+			desc: "Digits below the minimum should be rejected",
+			uri:  "otpauth://totp/exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=6",
+			opts: []Option{WithMinDigits(8)},
+			err:  ErrDigitsOutOfRange,
+		},
+		{
+			desc: "Default digits below the minimum should be rejected",
+			uri:  "otpauth://totp/exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			opts: []Option{WithMinDigits(8)},
+			err:  ErrDigitsOutOfRange,
+		},
+		{
+			desc: "Default digits given by WithDigits should satisfy the minimum",
+			uri:  "otpauth://totp/exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			opts: []Option{WithMinDigits(8), WithDigits(8)},
+			ok:   true,
+		},
+		{
+			desc: "Digits in the range narrowed from both sides should be accepted",
+			uri:  "otpauth://totp/exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8",
+			opts: []Option{WithMinDigits(8), WithMaxDigits(8)},
+			ok:   true,
+		},
+		{
+			desc: "Digits above the narrowed maximum should be rejected",
+			uri:  "otpauth://totp/exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=10",
+			opts: []Option{WithMinDigits(8), WithMaxDigits(8)},
+			err:  ErrDigitsOutOfRange,
+		},
+		{
+			desc: "Minimum greater than the maximum should be rejected",
+			uri:  "otpauth://totp/exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8",
+			opts: []Option{WithMinDigits(12)},
+		},
+		{
+			desc: "Minimum out of range should be rejected",
+			uri:  "otpauth://totp/exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8",
+			opts: []Option{WithMinDigits(5)},
+		},
+	}
+	for _, c := range cases {
+		_, err := NewToken(c.uri, c.opts...)
+		if c.ok {
+			if err != nil {
+				t.Errorf("[CASE] %v", c.desc)
+				t.Errorf("Got unexpected error: %v", err)
+			}
+			continue
+		}
+		if err == nil || (c.err != nil && !errors.Is(err, c.err)) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+		}
+	}
+
+	if _, err := NewTokenFromParams([]byte("12345678901234567890"), WithMinDigits(8)); !errors.Is(err, ErrDigitsOutOfRange) {
+		t.Errorf("Expected: %v, Actual: %v", ErrDigitsOutOfRange, err)
+	}
+	if _, err := NewTokenFromParams([]byte("12345678901234567890"), WithMinDigits(8), WithDigits(8)); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+}
+
+func TestGenerateWithNineAndTenDigits(t *testing.T) {
+	uriTpl := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=%v"
+	nine, err := NewToken(fmt.Sprintf(uriTpl, 9))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	ten, err := NewToken(fmt.Sprintf(uriTpl, 10))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		time string
+		nine string
+		ten  string
+	}{
+		{"1970-01-01T00:00:59Z", "094287082", "1094287082"},
+		{"2005-03-18T01:58:29Z", "907081804", "0907081804"},
+		{"2033-05-18T03:33:20Z", "069279037", "2069279037"},
+		{"2603-10-11T11:33:20Z", "465353130", "1465353130"},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		if otp := nine.Generate(tm); otp != c.nine {
+			t.Errorf("9-digit OTP didn't match for %v. Expected: %q, Actual: %q", c.time, c.nine, otp)
+		}
+		if otp := ten.Generate(tm); otp != c.ten {
+			t.Errorf("10-digit OTP didn't match for %v. Expected: %q, Actual: %q", c.time, c.ten, otp)
+		}
+	}
+
+	// The modulus should be exact for every counter, so that 10-digit OTPs are the 31-bit truncated values themselves
+	// and 9-digit OTPs are their last 9 digits.
+	for u := int64(0); u < 1000; u++ {
+		n := truncateWith(hmac.New(ten.algorithm.proc, ten.secret), message(u))
+		if otp := ten.generate(u); otp != fmt.Sprintf("%010d", n) {
+			t.Fatalf("10-digit OTP didn't match for counter %v. Expected: %010d, Actual: %q", u, n, otp)
+		}
+		if otp := nine.generate(u); otp != fmt.Sprintf("%09d", n%1_000_000_000) {
+			t.Fatalf("9-digit OTP didn't match for counter %v. Expected: %09d, Actual: %q", u, n%1_000_000_000, otp)
+		}
+	}
+}
+
+func TestGenerateInt(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		time string
+		otp  uint32
+	}{
+		{"1970-01-01T00:00:59Z", 94287082},
+		{"2005-03-18T01:58:29Z", 7081804},
+		{"2009-02-13T23:31:30Z", 89005924},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		if otp := tk.GenerateInt(tm); otp != c.otp {
+			t.Errorf("OTP didn't match for %v. Expected: %v, Actual: %v", c.time, c.otp, otp)
+		}
+	}
+}
+
+func TestGenerateRange(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	base, err := time.Parse(time.RFC3339, "2005-03-18T01:58:00Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+
+	cases := []struct {
+		desc  string
+		start time.Time
+		end   time.Time
+		count int
+	}{
+		{"Range of a single period should yield one code", base, base.Add(30 * time.Second), 1},
+		{"Range ending right after a boundary should include the next period", base, base.Add(31 * time.Second), 2},
+		{"Range starting in the middle of a period should include it", base.Add(29 * time.Second), base.Add(31 * time.Second), 2},
+		{"Range of 5 minutes should yield 10 codes", base, base.Add(5 * time.Minute), 10},
+		{"Empty range should yield nothing", base, base, 0},
+		{"Reversed range should yield nothing", base.Add(time.Minute), base, 0},
+		{"Range of 10000 periods should yield 10000 codes", base, base.Add(10000 * 30 * time.Second), 10000},
+		{"Range of more than 10000 periods should yield nothing", base, base.Add(10001 * 30 * time.Second), 0},
+		{"Huge range should yield nothing", time.Unix(0, 0), time.Unix(1<<50, 0), 0},
+		{"Range across the whole int64 should yield nothing", time.Unix(math.MinInt64, 0), time.Unix(math.MaxInt64, 0), 0},
+	}
+	for _, c := range cases {
+		codes := tk.GenerateRange(c.start, c.end)
+		if len(codes) != c.count {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Number of codes didn't match. Expected: %v, Actual: %v", c.count, len(codes))
+			continue
+		}
+		// Each code should match the one generated for its period.
+		for i, code := range codes {
+			m := c.start.Add(time.Duration(i) * 30 * time.Second)
+			if expected := tk.Generate(m); code != expected {
+				t.Errorf("[CASE] %v", c.desc)
+				t.Errorf("Code #%v didn't match. Expected: %q, Actual: %q", i+1, expected, code)
+			}
+		}
+	}
+}
+
+func TestGenerateCurrentAndNext(t *testing.T) {
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+
+	current, next := tk.GenerateCurrentAndNext(tm)
+	if current != "07081804" {
+		t.Errorf("Current OTP didn't match. Expected: %q, Actual: %q", "07081804", current)
+	}
+	if next != "14050471" {
+		t.Errorf("Next OTP didn't match. Expected: %q, Actual: %q", "14050471", next)
+	}
+}
+
+func TestWithMinSecretBits(t *testing.T) {
+	// The secret is 160 bits long.
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	cases := []struct {
+		desc string
+		bits int
+		ok   bool
+	}{
+		{"No minimum should accept the secret", 0, true},
+		{"Minimum of 128 bits should accept the secret", 128, true},
+		{"Minimum of 160 bits should accept the secret", 160, true},
+		{"Minimum of 161 bits should reject the secret", 161, false},
+		{"Minimum of 256 bits should reject the secret", 256, false},
+		{"Negative minimum should be rejected", -1, false},
+	}
+	for _, c := range cases {
+		_, err := NewToken(uri, WithMinSecretBits(c.bits))
+		if c.ok && err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Error("Expected an error but didn't get one")
+		}
+
+		_, err = NewTokenFromParams([]byte("12345678901234567890"), WithMinSecretBits(c.bits))
+		if c.ok && err != nil {
+			t.Errorf("[CASE] %v (NewTokenFromParams)", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("[CASE] %v (NewTokenFromParams)", c.desc)
+			t.Error("Expected an error but didn't get one")
+		}
+	}
+}
+
+func TestWithSecretNormalization(t *testing.T) {
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	// The secret is 80 bits long.
+	uri := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQ"
+	plain, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	cases := []struct {
+		desc     string
+		bits     int
+		expected []byte
+		ok       bool
+	}{
+		{"No normalization should keep the secret", 0, []byte("1234567890"), true},
+		{"Shorter length should keep the secret", 64, []byte("1234567890"), true},
+		{"Longer length should pad the secret", 128, []byte("1234567890\x00\x00\x00\x00\x00\x00"), true},
+		{"Negative length should be rejected", -8, nil, false},
+		{"Length other than multiple of 8 should be rejected", 100, nil, false},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(uri, WithSecretNormalization(c.bits))
+		if !c.ok {
+			if err == nil {
+				t.Errorf("[CASE] %v", c.desc)
+				t.Error("Expected an error but didn't get one")
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if actual := tk.SecretBytes(); string(actual) != string(c.expected) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.expected, actual)
+		}
+		// Padding within the block size of the hash function doesn't change OTPs.
+		if tk.Generate(tm) != plain.Generate(tm) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", plain.Generate(tm), tk.Generate(tm))
+		}
+
+		tk, err = NewTokenFromParams([]byte("1234567890"), WithSecretNormalization(c.bits))
+		if err != nil {
+			t.Errorf("[CASE] %v (NewTokenFromParams)", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if actual := tk.SecretBytes(); string(actual) != string(c.expected) {
+			t.Errorf("[CASE] %v (NewTokenFromParams)", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.expected, actual)
+		}
+	}
+
+	// The padded secret satisfies the minimum length.
+	if _, err := NewToken(uri, WithSecretNormalization(128), WithMinSecretBits(128)); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+
+	if _, err := NewToken(uri, WithSecretNormalization(8192)); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	for _, bits := range []int{-8, 12, 8200, math.MaxInt32 - 7} {
+		if _, err := NewToken(uri, WithSecretNormalization(bits)); err == nil {
+			t.Errorf("Expected an error for bits %v but didn't get one", bits)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	base := "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example"
+	cases := []struct {
+		desc     string
+		uri      string
+		expected bool
+	}{
+		{
+			desc:     "Same Key URI should be equal",
+			uri:      base,
+			expected: true,
+		},
+		{
+			desc:     "Explicit default parameters should be equal",
+			uri:      base + "&algorithm=SHA1&digits=6&period=30",
+			expected: true,
+		},
+		{
+			desc:     "Different secret should not be equal",
+			uri:      "otpauth://totp/Example:alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Example",
+			expected: false,
+		},
+		{
+			desc:     "Different label should not be equal",
+			uri:      "otpauth://totp/Example:bob@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example",
+			expected: false,
+		},
+		{
+			desc:     "Different algorithm should not be equal",
+			uri:      base + "&algorithm=SHA256",
+			expected: false,
+		},
+		{
+			desc:     "Different digits should not be equal",
+			uri:      base + "&digits=8",
+			expected: false,
+		},
+		{
+			desc:     "Different period should not be equal",
+			uri:      base + "&period=60",
+			expected: false,
+		},
+		{
+			desc:     "HOTP should not be equal to TOTP",
+			uri:      "otpauth://hotp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&counter=0",
+			expected: false,
+		},
+	}
+
+	tk, err := NewToken(base)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	for _, c := range cases {
+		other, err := NewToken(c.uri)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if actual := tk.Equal(other); actual != c.expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.expected, actual)
+		}
+	}
+
+	var nilToken *Token
+	if !nilToken.Equal(nil) {
+		t.Error("Two nil tokens should be equal")
+	}
+	if nilToken.Equal(tk) || tk.Equal(nil) {
+		t.Error("Nil token should not be equal to non-nil token")
+	}
+}
+
+func TestClone(t *testing.T) {
+	tk, err := NewToken("otpauth://hotp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&counter=42")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	expected := tk.String()
+
+	c := tk.Clone()
+	if !c.Equal(tk) {
+		t.Errorf("Clone should be equal to the source. Expected: %q, Actual: %q", expected, c.String())
+	}
+
+	c.secret[0] ^= 0xff
+	if tk.String() != expected {
+		t.Errorf("Modifying the clone's secret should not affect the source. Expected: %q, Actual: %q", expected, tk.String())
+	}
+
+	c.Destroy()
+	if tk.GenerateHOTP(0) == "" {
+		t.Error("Destroying the clone should not affect the source")
+	}
+}
+
+func TestSetters(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	if err := tk.SetDigits(8); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	if err := tk.SetPeriod(60); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	if err := tk.SetAlgorithm("SHA256"); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	tk.SetIssuer("Example Co")
+	expected := "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example%20Co&algorithm=SHA256&digits=8&period=60"
+	if tk.String() != expected {
+		t.Errorf("Expected: %q, Actual: %q", expected, tk.String())
+	}
+
+	cases := []struct {
+		desc string
+		set  func() error
+		err  error
+	}{
+		{
+			desc: "Too few digits should be rejected",
+			set:  func() error { return tk.SetDigits(5) },
+			err:  ErrDigitsOutOfRange,
+		},
+		{
+			desc: "Too many digits should be rejected",
+			set:  func() error { return tk.SetDigits(11) },
+			err:  ErrDigitsOutOfRange,
+		},
+		{
+			desc: "Zero period should be rejected",
+			set:  func() error { return tk.SetPeriod(0) },
+			err:  ErrPeriodOutOfRange,
+		},
+		{
+			desc: "Too long period should be rejected",
+			set:  func() error { return tk.SetPeriod(91) },
+			err:  ErrPeriodOutOfRange,
+		},
+		{
+			desc: "Unknown algorithm should be rejected",
+			set:  func() error { return tk.SetAlgorithm("MD5") },
+			err:  ErrInvalidAlgorithm,
+		},
+	}
+	for _, c := range cases {
+		if err := c.set(); !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+		}
+	}
+	if tk.String() != expected {
+		t.Errorf("Token should be left unchanged on error. Expected: %q, Actual: %q", expected, tk.String())
+	}
+}
+
+// TestConcurrentGenerateAndSet is meant to be run with the race detector enabled.
+func TestConcurrentGenerateAndSet(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				code := tk.Generate(tm)
+				if n := len(code); n != 6 && n != 8 {
+					t.Errorf("Unexpected OTP %q", code)
+				}
+				tk.VerifyWithSkew(code, tm, 1)
+				_ = tk.String()
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			if err := tk.SetPeriod(30 + j%2*30); err != nil {
+				t.Errorf("Got unexpected error: %v", err)
+			}
+			if err := tk.SetDigits(6 + j%2*2); err != nil {
+				t.Errorf("Got unexpected error: %v", err)
+			}
+			if err := tk.SetAlgorithm([]string{"SHA1", "SHA256"}[j%2]); err != nil {
+				t.Errorf("Got unexpected error: %v", err)
+			}
+			tk.SetIssuer("Example")
+		}
+	}()
+	wg.Wait()
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	tm := time.Unix(1111111109, 0)
+	for _, algorithm := range []string{"SHA1", "SHA256", "SHA512"} {
+		b.Run(algorithm, func(b *testing.B) {
+			tk, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&algorithm=" + algorithm)
+			if err != nil {
+				b.Fatalf("Got unexpected error: %v", err)
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tk.Generate(tm)
+			}
+		})
+	}
+}
+
+// BenchmarkGenerateWithoutCache sets up a new HMAC state for every OTP, which is how Generate used to work. It serves
+// as a baseline for BenchmarkGenerate.
+func BenchmarkGenerateWithoutCache(b *testing.B) {
+	tk, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example")
+	if err != nil {
+		b.Fatalf("Got unexpected error: %v", err)
+	}
+	u := time.Unix(1111111109, 0).Unix() / int64(tk.period)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tk.render(truncateWith(hmac.New(tk.algorithm.proc, tk.secret), message(u)))
+	}
+}
+
+func TestCachedMACInvalidation(t *testing.T) {
+	tm := time.Unix(1111111109, 0)
+	tk, err := NewToken("otpauth://totp/Example:alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if actual := tk.Generate(tm); actual != "07081804" {
+		t.Errorf("Expected: %q, Actual: %q", "07081804", actual)
+	}
+
+	if err := tk.SetAlgorithm("SHA512"); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	// The secret is too short for RFC 6238's SHA512 vector, so compare against a fresh token instead.
+	fresh, err := NewToken("otpauth://totp/Example:alice@google.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8&algorithm=SHA512")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if expected, actual := fresh.Generate(tm), tk.Generate(tm); actual != expected {
+		t.Errorf("Cached HMAC state should be discarded after SetAlgorithm. Expected: %q, Actual: %q", expected, actual)
+	}
+
+	tk.Destroy()
+	if actual := tk.Generate(tm); actual != "" {
+		t.Errorf("Cached HMAC state should be discarded after Destroy. Got: %q", actual)
+	}
+}
+
+func BenchmarkVerifyWithSkew(b *testing.B) {
+	tk, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP")
+	if err != nil {
+		b.Fatalf("Got unexpected error: %v", err)
+	}
+	tm := time.Unix(1111111109, 0)
+	for _, skew := range []int{0, 1, 2, 5} {
+		// The earliest step in the window is the last one checked, which is the worst case.
+		code := tk.Generate(tm.Add(-time.Duration(skew) * tk.PeriodDuration()))
+		b.Run(fmt.Sprintf("skew=%v", skew), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !tk.VerifyWithSkew(code, tm, skew) {
+					b.Fatal("Code should be accepted")
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyHOTP(t *testing.T) {
+	tk, err := NewToken("otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=0")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	// The values of HOTP in Appendix D of RFC 4226.
+	cases := []struct {
+		desc      string
+		code      string
+		server    uint64
+		lookAhead int
+		counter   uint64
+		ok        bool
+	}{
+		{"Code for the server counter should be accepted", "755224", 0, 0, 0, true},
+		{"Code ahead of the server counter should be accepted", "359152", 0, 3, 2, true},
+		{"Code at the end of the window should be accepted", "969429", 0, 3, 3, true},
+		{"Code beyond the window should be rejected", "338314", 0, 3, 0, false},
+		{"Code behind the server counter should be rejected", "755224", 1, 3, 0, false},
+		{"Negative look-ahead should be treated as zero", "287082", 1, -1, 1, true},
+		{"Code with a wrong length should be rejected", "75522", 0, 3, 0, false},
+	}
+	for _, c := range cases {
+		counter, ok := tk.VerifyHOTP(c.code, c.server, c.lookAhead)
+		if counter != c.counter || ok != c.ok {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%v, %v), Actual: (%v, %v)", c.counter, c.ok, counter, ok)
+		}
+	}
+
+	// The window doesn't wrap around the maximum counter.
+	if _, ok := tk.VerifyHOTP("755224", math.MaxUint64, 3); ok {
+		t.Error("Window should not wrap around")
+	}
+}
+
+func TestGenerateHOTPWithHighBitSet(t *testing.T) {
+	// The most significant bit of the counter has to be kept. The expected values are calculated with Python's hmac
+	// module.
+	tk, err := NewToken("otpauth://hotp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=0")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	cases := []struct {
+		desc     string
+		counter  uint64
+		expected string
+	}{
+		{
+			desc:     "Counter 2^63 should not collide with counter 0",
+			counter:  1 << 63,
+			expected: "959616",
+		},
+		{
+			desc:     "Counter 2^63 + 1 should not collide with counter 1",
+			counter:  1<<63 + 1,
+			expected: "778056",
+		},
+		{
+			desc:     "Largest counter should be packed as is",
+			counter:  1<<64 - 1,
+			expected: "094451",
+		},
+	}
+	for _, c := range cases {
+		if otp := tk.GenerateHOTP(c.counter); otp != c.expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.expected, otp)
+		}
+	}
+}
+
+func TestGenerateContext(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tm, err := time.Parse(time.RFC3339, "2005-03-18T01:58:29Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+
+	otp, err := tk.GenerateContext(context.Background(), tm)
+	if err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	if expected := tk.Generate(tm); otp != expected {
+		t.Errorf("Expected: %q, Actual: %q", expected, otp)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if otp, err := tk.GenerateContext(ctx, tm); !errors.Is(err, context.Canceled) || otp != "" {
+		t.Errorf("Expected: (%q, %v), Actual: (%q, %v)", "", context.Canceled, otp, err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Unix(0, 0))
+	defer cancel()
+	if _, err := tk.GenerateContext(ctx, tm); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected: %v, Actual: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestValidateURI(t *testing.T) {
+	cases := []struct {
+		desc string
+		uri  string
+		opts []Option
+		err  error
+	}{
+		{
+			desc: "Valid TOTP URI should pass",
+			uri:  "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example",
+		},
+		{
+			desc: "Valid HOTP URI should pass",
+			uri:  "otpauth://hotp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&counter=42",
+		},
+		{
+			desc: "Invalid scheme should be reported",
+			uri:  "https://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP",
+			err:  ErrInvalidScheme,
+		},
+		{
+			desc: "Missing secret should be reported",
+			uri:  "otpauth://totp/Example:alice@google.com",
+			err:  ErrMissingSecret,
+		},
+		{
+			desc: "Missing counter should be reported",
+			uri:  "otpauth://hotp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP",
+			err:  ErrMissingCounter,
+		},
+		{
+			desc: "Options should be applied",
+			uri:  "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&digits=12",
+			opts: []Option{WithMaxDigits(12)},
+		},
+	}
+	for _, c := range cases {
+		err := ValidateURI(c.uri, c.opts...)
+		if c.err == nil && err != nil || !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+		}
+		var pe *ParseError
+		if err != nil && !errors.As(err, &pe) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected a *ParseError. Got: %v", err)
+		}
+	}
+}
+
+func BenchmarkValidateURI(b *testing.B) {
+	uri := "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := ValidateURI(uri); err != nil {
+			b.Fatalf("Got unexpected error: %v", err)
+		}
+	}
+}
+
+func TestUnknownParams(t *testing.T) {
+	uri := "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&icon=https%3A%2F%2Fexample.com%2Flogo.png&color=dark%20blue"
+	tk, err := NewToken(uri)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	expected := "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&algorithm=SHA1&digits=6&period=30&color=dark%20blue&icon=https%3A%2F%2Fexample.com%2Flogo.png"
+	if tk.String() != expected {
+		t.Errorf("Expected: %q, Actual: %q", expected, tk.String())
+	}
+
+	rt, err := NewToken(tk.String())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if rt.String() != expected {
+		t.Errorf("Unknown parameters should round-trip. Expected: %q, Actual: %q", expected, rt.String())
+	}
+
+	_, err = NewToken(uri, WithStrictParams())
+	var pe *ParseError
+	if !errors.Is(err, ErrUnknownParameter) || !errors.As(err, &pe) {
+		t.Fatalf("Expected: %v, Actual: %v", ErrUnknownParameter, err)
+	}
+	// Unknown parameters are reported in the order of their names.
+	if pe.Field != "color" || pe.Value != "dark blue" {
+		t.Errorf("Expected: (%q, %q), Actual: (%q, %q)", "color", "dark blue", pe.Field, pe.Value)
+	}
+
+	if _, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&period=60", WithStrictParams()); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+}
+
+func TestDuplicateParams(t *testing.T) {
+	cases := []struct {
+		desc  string
+		uri   string
+		field string
+	}{
+		{
+			desc:  "Duplicated secret should be rejected",
+			uri:   "otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			field: "secret",
+		},
+		{
+			desc:  "Duplicated algorithm should be rejected",
+			uri:   "otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&algorithm=SHA1&algorithm=SHA256",
+			field: "algorithm",
+		},
+		{
+			desc:  "Duplicated digits should be rejected",
+			uri:   "otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&digits=6&digits=6",
+			field: "digits",
+		},
+		{
+			desc:  "Duplicated period should be rejected",
+			uri:   "otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&period=30&period=60",
+			field: "period",
+		},
+	}
+	for _, c := range cases {
+		// Only the first value is used by default.
+		if _, err := NewToken(c.uri); err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+		}
+
+		_, err := NewToken(c.uri, WithStrictParams())
+		var pe *ParseError
+		if !errors.Is(err, ErrDuplicateParameter) || !errors.As(err, &pe) || pe.Field != c.field {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v on %q, Actual: %v", ErrDuplicateParameter, c.field, err)
+		}
+	}
+
+	tk, err := NewToken("otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if tk.SecretBase32() != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Expected: %q, Actual: %q", "JBSWY3DPEHPK3PXP", tk.SecretBase32())
+	}
+}
+
+func TestWithLenientHost(t *testing.T) {
+	cases := []struct {
+		desc  string
+		uri   string
+		typ   string
+		label string
+		ok    bool
+	}{
+		{
+			desc:  "Type in the host should be accepted",
+			uri:   "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP",
+			typ:   "totp",
+			label: "Example:alice@google.com",
+			ok:    true,
+		},
+		{
+			desc:  "Type in the path after an empty host should be accepted",
+			uri:   "otpauth:///totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP",
+			typ:   "totp",
+			label: "Example:alice@google.com",
+			ok:    true,
+		},
+		{
+			desc:  "Type in the path without an authority should be accepted",
+			uri:   "otpauth:/hotp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&counter=1",
+			typ:   "hotp",
+			label: "Example:alice@google.com",
+			ok:    true,
+		},
+		{
+			desc:  "Type in the path without a label should be accepted",
+			uri:   "otpauth:///totp?secret=JBSWY3DPEHPK3PXP",
+			typ:   "totp",
+			label: "",
+			ok:    true,
+		},
+		{
+			desc: "Unknown type in the path should be rejected",
+			uri:  "otpauth:///motp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP",
+			ok:   false,
+		},
+		{
+			desc: "Type in the path after another host should be rejected",
+			uri:  "otpauth://example.com/totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP",
+			ok:   false,
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri, WithLenientHost())
+		if !c.ok {
+			if !errors.Is(err, ErrInvalidHost) {
+				t.Errorf("[CASE] %v", c.desc)
+				t.Errorf("Expected: %v, Actual: %v", ErrInvalidHost, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if tk.Type() != c.typ || tk.Label() != c.label {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%q, %q), Actual: (%q, %q)", c.typ, c.label, tk.Type(), tk.Label())
+		}
+	}
+
+	// The type in the path is rejected by default.
+	if _, err := NewToken("otpauth:///totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP"); !errors.Is(err, ErrInvalidHost) {
+		t.Errorf("Expected: %v, Actual: %v", ErrInvalidHost, err)
+	}
+}
+
+func TestLabelDecodingInNewToken(t *testing.T) {
+	cases := []struct {
+		desc    string
+		uri     string
+		label   string
+		account string
+	}{
+		{
+			desc:    "URL-encoded characters should be decoded",
+			uri:     "otpauth://totp/ACME%20Co%3Ajohn.doe%40email.com?secret=JBSWY3DPEHPK3PXP",
+			label:   "ACME Co:john.doe@email.com",
+			account: "john.doe@email.com",
+		},
+		{
+			desc:    "URL-encoded slashes should be kept",
+			uri:     "otpauth://totp/Example:%2Fhome%2Falice%2F?secret=JBSWY3DPEHPK3PXP",
+			label:   "Example:/home/alice/",
+			account: "/home/alice/",
+		},
+		{
+			desc:    "Literal slashes around the label should be trimmed",
+			uri:     "otpauth://totp//alice@google.com/?secret=JBSWY3DPEHPK3PXP",
+			label:   "alice@google.com",
+			account: "alice@google.com",
+		},
+		{
+			desc:    "Repeated slashes around the label should be trimmed",
+			uri:     "otpauth://totp//Example:alice//?secret=JBSWY3DPEHPK3PXP",
+			label:   "Example:alice",
+			account: "alice",
+		},
+		{
+			desc:    "Fragment should be ignored",
+			uri:     "otpauth://totp//Example:alice//?secret=JBSWY3DPEHPK3PXP#foo",
+			label:   "Example:alice",
+			account: "alice",
+		},
+		{
+			desc:    "Empty fragment should be ignored",
+			uri:     "otpauth://totp/Example:alice?secret=JBSWY3DPEHPK3PXP#",
+			label:   "Example:alice",
+			account: "alice",
+		},
+		{
+			desc:    "Account name should keep spaces other than the leading ones",
+			uri:     "otpauth://totp/Example:%20Alice%20Smith?secret=JBSWY3DPEHPK3PXP",
+			label:   "Example: Alice Smith",
+			account: "Alice Smith",
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if tk.Label() != c.label || tk.AccountName() != c.account {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%q, %q), Actual: (%q, %q)", c.label, c.account, tk.Label(), tk.AccountName())
+		}
+	}
+}
+
+func TestLabelWithSlash(t *testing.T) {
+	cases := []struct {
+		desc string
+		uri  string
+	}{
+		{"Literal slash inside the label should be rejected", "otpauth://totp/Example:home/alice?secret=JBSWY3DPEHPK3PXP"},
+		{"Literal slash between issuer and account should be rejected", "otpauth://totp/Example/alice?secret=JBSWY3DPEHPK3PXP"},
+	}
+	for _, c := range cases {
+		_, err := NewToken(c.uri)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Field != "label" || !errors.Is(err, ErrInvalidURI) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected an error on label. Got %v", err)
+		}
+	}
+
+	// Slashes in a supplied label are URL-encoded so that the label is parsed back as it is.
+	tk, err := NewTokenFromParams([]byte("12345678901234567890"), WithLabel("Example:home/alice"))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	expected := "otpauth://totp/Example:home%2Falice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=SHA1&digits=6&period=30"
+	if tk.String() != expected {
+		t.Errorf("Expected: %q, Actual: %q", expected, tk.String())
+	}
+	other, err := NewToken(tk.String())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if other.Label() != "Example:home/alice" {
+		t.Errorf("Expected: %q, Actual: %q", "Example:home/alice", other.Label())
+	}
+}
+
+func TestImage(t *testing.T) {
+	uri := "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&image=https%3A%2F%2Fexample.com%2Flogo.png"
+	tk, err := NewToken(uri, WithStrictParams())
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if expected := "https://example.com/logo.png"; tk.Image() != expected {
+		t.Errorf("Expected: %q, Actual: %q", expected, tk.Image())
+	}
+	expected := "otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&algorithm=SHA1&digits=6&period=30&image=https%3A%2F%2Fexample.com%2Flogo.png"
+	if tk.String() != expected {
+		t.Errorf("Expected: %q, Actual: %q", expected, tk.String())
+	}
+
+	for _, image := range []string{"", "logo.png", "/logo.png", "https://"} {
+		_, err := NewToken("otpauth://totp/alice@google.com?secret=JBSWY3DPEHPK3PXP&image=" + url.QueryEscape(image))
+		if !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("Expected: %v for image %q, Actual: %v", ErrInvalidImage, image, err)
+		}
+		if _, err := NewTokenFromParams([]byte("12345678901234567890"), WithImage(image)); !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("Expected: %v for image %q, Actual: %v", ErrInvalidImage, image, err)
+		}
+	}
+}
+
+func TestNewRandomToken(t *testing.T) {
+	cases := []struct {
+		desc  string
+		opts  []Option
+		bytes int
+	}{
+		{
+			desc:  "Secret should be 160 bits by default",
+			bytes: 20,
+		},
+		{
+			desc:  "Secret length should be changed by WithSecretBits",
+			opts:  []Option{WithSecretBits(256), WithAlgorithm("SHA256")},
+			bytes: 32,
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewRandomToken(c.opts...)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if n := len(tk.SecretBytes()); n != c.bytes {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.bytes, n)
+		}
+		other, err := NewRandomToken(c.opts...)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if tk.Equal(other) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Error("Random secrets should differ")
+		}
+	}
+
+	for _, bits := range []int{0, 120, 161} {
+		if _, err := NewRandomToken(WithSecretBits(bits)); err == nil {
+			t.Errorf("Expected an error for secret bits %v but didn't get one", bits)
+		}
+	}
+	if _, err := NewRandomToken(WithMinSecretBits(256)); !errors.Is(err, ErrSecretTooShort) {
+		t.Errorf("Expected: %v, Actual: %v", ErrSecretTooShort, err)
+	}
+}
+
+func TestWithRandSource(t *testing.T) {
+	source := strings.NewReader("12345678901234567890")
+	tk, err := NewRandomToken(WithRandSource(source))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if expected := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"; tk.SecretBase32() != expected {
+		t.Errorf("Expected: %q, Actual: %q", expected, tk.SecretBase32())
+	}
+
+	// The source has been exhausted.
+	if _, err := NewRandomToken(WithRandSource(source)); err == nil {
+		t.Error("Expected an error but didn't get one")
+	}
+	if _, err := NewRandomToken(WithRandSource(strings.NewReader("too short"))); err == nil {
+		t.Error("Expected an error but didn't get one")
+	}
+	if _, err := NewRandomToken(WithRandSource(nil)); err == nil {
+		t.Error("Expected an error but didn't get one")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	for _, bits := range []int{128, 160, 256} {
+		secret, err := GenerateSecret(bits)
+		if err != nil {
+			t.Errorf("Got unexpected error for %v bits: %v", bits, err)
+			continue
+		}
+		if strings.ToUpper(secret) != secret || strings.Contains(secret, "=") {
+			t.Errorf("Secret should be uppercase Base32 without padding. Got %q", secret)
+		}
+		raw, err := decodeSecret(secret)
+		if err != nil {
+			t.Errorf("Got unexpected error for %v bits: %v", bits, err)
+			continue
+		}
+		if len(raw)*8 != bits {
+			t.Errorf("Expected: %v bits, Actual: %v bits", bits, len(raw)*8)
+		}
+	}
+
+	for _, bits := range []int{-8, 0, 64, 120, 130} {
+		if _, err := GenerateSecret(bits); err == nil {
+			t.Errorf("Expected an error for %v bits but didn't get one", bits)
+		}
+	}
+}
+
+func TestEncodeAndDecodeSecret(t *testing.T) {
+	if actual := EncodeSecret([]byte("12345678901234567890")); actual != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("Expected: %q, Actual: %q", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", actual)
+	}
+
+	cases := []struct {
+		desc     string
+		secret   string
+		expected []byte
+		err      error
+	}{
+		{
+			desc:     "Uppercase secret should be decoded",
+			secret:   "JBSWY3DPEHPK3PXP",
+			expected: []byte("Hello!\xde\xad\xbe\xef"),
+		},
+		{
+			desc:     "Lowercase secret should be decoded",
+			secret:   "jbswy3dpehpk3pxp",
+			expected: []byte("Hello!\xde\xad\xbe\xef"),
+		},
+		{
+			desc:     "Padded secret should be decoded",
+			secret:   "JBSWY3DPEE======",
+			expected: []byte("Hello!"),
+		},
+		{
+			desc:     "Grouped secret should be decoded",
+			secret:   "JBSW Y3DP-EHPK 3PXP",
+			expected: []byte("Hello!\xde\xad\xbe\xef"),
+		},
+		{
+			desc:   "Empty secret should be rejected",
+			secret: "",
+			err:    ErrInvalidSecret,
+		},
+		{
+			desc:   "Secret not in Base32 should be rejected",
+			secret: "JBSWY3DPEHPK3PX1",
+			err:    ErrInvalidSecret,
+		},
+	}
+	for _, c := range cases {
+		actual, err := DecodeSecret(c.secret)
+		if !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+			continue
+		}
+		if string(actual) != string(c.expected) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.expected, actual)
+		}
+		// Secrets are encoded in the same way as NewToken does.
+		if err == nil {
+			tk, err := NewToken("otpauth://totp/exampleuser?secret=" + url.QueryEscape(c.secret))
+			if err != nil {
+				t.Errorf("[CASE] %v", c.desc)
+				t.Errorf("Got unexpected error: %v", err)
+				continue
+			}
+			if tk.SecretBase32() != EncodeSecret(actual) {
+				t.Errorf("[CASE] %v", c.desc)
+				t.Errorf("Expected: %q, Actual: %q", tk.SecretBase32(), EncodeSecret(actual))
+			}
+		}
+	}
+}
+
+func TestCounter(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&period=60")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	cases := []struct {
+		time    string
+		counter int64
+	}{
+		{"1970-01-01T00:00:00Z", 0},
+		{"1970-01-01T00:00:59Z", 0},
+		{"1970-01-01T00:01:00Z", 1},
+		{"2009-02-13T23:31:30Z", 20576131},
+		{"1969-12-31T23:59:59Z", -1},
+		{"1969-12-31T23:59:00Z", -1},
+		{"1969-12-31T23:58:59Z", -2},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		if counter := tk.Counter(tm); counter != c.counter {
+			t.Errorf("Counter didn't match for %v. Expected: %v, Actual: %v", c.time, c.counter, counter)
+			continue
+		}
+		if expected, actual := tk.GenerateHOTP(uint64(c.counter)), tk.Generate(tm); actual != expected {
+			t.Errorf("TOTP should be HOTP of the counter for %v. Expected: %q, Actual: %q", c.time, expected, actual)
+		}
+	}
+}
+
+func TestPeriodStartAndEnd(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	cases := []struct {
+		desc  string
+		time  string
+		start string
+		end   string
+	}{
+		{
+			desc:  "Time in the middle of a period",
+			time:  "2009-02-13T23:31:45Z",
+			start: "2009-02-13T23:31:30Z",
+			end:   "2009-02-13T23:32:00Z",
+		},
+		{
+			desc:  "Time on a period boundary should start a new period",
+			time:  "2009-02-13T23:31:30Z",
+			start: "2009-02-13T23:31:30Z",
+			end:   "2009-02-13T23:32:00Z",
+		},
+		{
+			desc:  "Time in another location should be returned in UTC",
+			time:  "2009-02-14T08:31:59+09:00",
+			start: "2009-02-13T23:31:30Z",
+			end:   "2009-02-13T23:32:00Z",
+		},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		start, end := tk.PeriodStart(tm).Format(time.RFC3339), tk.PeriodEnd(tm).Format(time.RFC3339)
+		if start != c.start || end != c.end {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%v, %v), Actual: (%v, %v)", c.start, c.end, start, end)
+		}
+	}
+}
+
+func TestNextExpiries(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	cases := []struct {
+		desc     string
+		time     string
+		n        int
+		expected []string
+	}{
+		{
+			desc:     "Time in the middle of a period",
+			time:     "2009-02-13T23:31:45Z",
+			n:        3,
+			expected: []string{"2009-02-13T23:32:00Z", "2009-02-13T23:32:30Z", "2009-02-13T23:33:00Z"},
+		},
+		{
+			desc:     "Time on a period boundary should expire a full period later",
+			time:     "2009-02-13T23:31:30Z",
+			n:        2,
+			expected: []string{"2009-02-13T23:32:00Z", "2009-02-13T23:32:30Z"},
+		},
+		{
+			desc:     "Time in another location should be returned in UTC",
+			time:     "2009-02-14T08:31:59+09:00",
+			n:        1,
+			expected: []string{"2009-02-13T23:32:00Z"},
+		},
+		{
+			desc:     "Zero should return nothing",
+			time:     "2009-02-13T23:31:45Z",
+			n:        0,
+			expected: nil,
+		},
+		{
+			desc:     "Negative should return nothing",
+			time:     "2009-02-13T23:31:45Z",
+			n:        -1,
+			expected: nil,
+		},
+		{
+			desc:     "More than 10000 should return nothing",
+			time:     "2009-02-13T23:31:45Z",
+			n:        10001,
+			expected: nil,
+		},
+		{
+			desc:     "Maximum int should return nothing",
+			time:     "2009-02-13T23:31:45Z",
+			n:        math.MaxInt,
+			expected: nil,
+		},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		var actual []string
+		for _, e := range tk.NextExpiries(tm, c.n) {
+			actual = append(actual, e.Format(time.RFC3339))
+		}
+		if strings.Join(actual, ",") != strings.Join(c.expected, ",") {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.expected, actual)
+		}
+	}
+	// Exactly 10000 expiries are still returned.
+	if expiries := tk.NextExpiries(time.Unix(0, 0), 10000); len(expiries) != 10000 {
+		t.Errorf("Expected: %v, Actual: %v", 10000, len(expiries))
+	}
+}
+
+func TestPeriodsWithin(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	cases := []struct {
+		desc     string
+		time     string
+		d        time.Duration
+		expected int
+	}{
+		{"Duration within the current period", "2009-02-13T23:31:45Z", 10 * time.Second, 0},
+		{"Duration reaching the next boundary", "2009-02-13T23:31:45Z", 15 * time.Second, 1},
+		{"Duration across two boundaries", "2009-02-13T23:31:45Z", 50 * time.Second, 2},
+		{"Boundary at the time should not be counted", "2009-02-13T23:31:30Z", 29 * time.Second, 0},
+		{"Boundary at the end should be counted", "2009-02-13T23:31:30Z", 30 * time.Second, 1},
+		{"Long duration", "2009-02-13T23:31:30Z", time.Hour, 120},
+		{"Time before the Unix epoch", "1969-12-31T23:59:45Z", 30 * time.Second, 1},
+		{"Zero duration", "2009-02-13T23:31:45Z", 0, 0},
+		{"Negative duration", "2009-02-13T23:31:45Z", -time.Minute, 0},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		if actual := tk.PeriodsWithin(tm, c.d); actual != c.expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.expected, actual)
+		}
+	}
+}
+
+func TestGenerateBeforeUnixEpoch(t *testing.T) {
+	// Counters are rounded down, and the expected values are calculated with Python's hmac module and floor division.
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	cases := []struct {
+		time      string
+		otp       string
+		remaining time.Duration
+	}{
+		{"1960-01-01T00:00:00Z", "79937785", 30 * time.Second},
+		{"1960-01-01T00:00:15Z", "79937785", 15 * time.Second},
+		{"1969-12-31T23:59:29Z", "89488204", 1 * time.Second},
+		{"1969-12-31T23:59:30Z", "63094451", 30 * time.Second},
+		{"1969-12-31T23:59:59Z", "63094451", 1 * time.Second},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		if otp := tk.Generate(tm); otp != c.otp {
+			t.Errorf("OTP didn't match for %v. Expected: %q, Actual: %q", c.time, c.otp, otp)
+		}
+		if remaining := tk.TimeRemaining(tm); remaining != c.remaining {
+			t.Errorf("Time remaining didn't match for %v. Expected: %v, Actual: %v", c.time, c.remaining, remaining)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	valid := func() *Token {
+		tk, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example")
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		return tk
+	}
+	cases := []struct {
+		desc    string
+		corrupt func(tk *Token)
+		err     error
+	}{
+		{
+			desc:    "Token built by NewToken should be valid",
+			corrupt: func(tk *Token) {},
+		},
+		{
+			desc:    "Destroyed token should be invalid",
+			corrupt: func(tk *Token) { tk.Destroy() },
+			err:     ErrMissingSecret,
+		},
+		{
+			desc:    "Too few digits should be invalid",
+			corrupt: func(tk *Token) { tk.digits = 0 },
+			err:     ErrDigitsOutOfRange,
+		},
+		{
+			desc:    "Zero period should be invalid",
+			corrupt: func(tk *Token) { tk.period = 0 },
+			err:     ErrPeriodOutOfRange,
+		},
+		{
+			desc:    "Unknown algorithm should be invalid",
+			corrupt: func(tk *Token) { tk.algorithm = algorithm{"MD5", nil} },
+			err:     ErrInvalidAlgorithm,
+		},
+		{
+			desc:    "Unknown type should be invalid",
+			corrupt: func(tk *Token) { tk.typ = "motp" },
+			err:     ErrInvalidHost,
+		},
+	}
+	for _, c := range cases {
+		tk := valid()
+		c.corrupt(tk)
+		err := tk.Valid()
+		if c.err == nil && err != nil || !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+		}
+	}
+
+	var zero Token
+	if err := zero.Valid(); err == nil {
+		t.Error("Zero token should be invalid")
+	}
+	var nilToken *Token
+	if err := nilToken.Valid(); err == nil {
+		t.Error("Nil token should be invalid")
+	}
+}
+
+func TestCaseInsensitiveAlgorithmInNewToken(t *testing.T) {
+	cases := []struct {
+		desc      string
+		algorithm string
+		expected  string
+	}{
+		{"Lowercase algorithm should be accepted", "sha1", "SHA1"},
+		{"Mixed case algorithm should be accepted", "Sha256", "SHA256"},
+		{"Lowercase SHA-3 algorithm should be accepted", "sha3-512", "SHA3-512"},
+	}
+	for _, c := range cases {
+		tk, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&algorithm=" + c.algorithm)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if tk.Algorithm() != c.expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.expected, tk.Algorithm())
+		}
+	}
+
+	for _, name := range []string{"md5", "MD5", "sha"} {
+		_, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&algorithm=" + name)
+		if !errors.Is(err, ErrInvalidAlgorithm) {
+			t.Errorf("Expected: %v for algorithm %q, Actual: %v", ErrInvalidAlgorithm, name, err)
+		}
+	}
+
+	if err := RegisterAlgorithm("sha256", sha512.New384); err == nil {
+		t.Error("Registering an algorithm differing from a built-in one only in case should fail")
+	}
+}
+
+func TestInfo(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&algorithm=SHA256&digits=8&period=60")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	expected := TokenInfo{
+		Label:       "Example:alice@google.com",
+		Issuer:      "Example",
+		AccountName: "alice@google.com",
+		Algorithm:   "SHA256",
+		Digits:      8,
+		Period:      60,
+	}
+	if info := tk.Info(); info != expected {
+		t.Errorf("Expected: %+v, Actual: %+v", expected, info)
+	}
+}
+
+func TestBase64SecretsInNewToken(t *testing.T) {
+	// "MTIzNDU2Nzg5MDEyMzQ1Njc4OTA" is "12345678901234567890" in URL-safe Base64.
+	base32Secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	cases := []struct {
+		desc   string
+		uri    string
+		opts   []Option
+		secret string
+		err    error
+	}{
+		{
+			desc:   "Base64 secret with the encoding hint should be decoded",
+			uri:    "otpauth://totp/Example:alice@google.com?secret=MTIzNDU2Nzg5MDEyMzQ1Njc4OTA&encoding=base64",
+			opts:   []Option{WithBase64Secrets()},
+			secret: base32Secret,
+		},
+		{
+			desc:   "Padded Base64 secret should be decoded",
+			uri:    "otpauth://totp/Example:alice@google.com?secret=MTIzNDU2Nzg5MDEyMzQ1Njc4OTA%3D&encoding=BASE64",
+			opts:   []Option{WithBase64Secrets()},
+			secret: base32Secret,
+		},
+		{
+			desc:   "Base64 secret should be decoded when Base32 fails",
+			uri:    "otpauth://totp/Example:alice@google.com?secret=MTIzNDU2Nzg5MDEyMzQ1Njc4OTA",
+			opts:   []Option{WithBase64Secrets()},
+			secret: base32Secret,
+		},
+		{
+			desc:   "Base32 secret should still be preferred without the encoding hint",
+			uri:    "otpauth://totp/Example:alice@google.com?secret=" + base32Secret,
+			opts:   []Option{WithBase64Secrets()},
+			secret: base32Secret,
+		},
+		{
+			desc: "Base64 secret should be rejected by default",
+			uri:  "otpauth://totp/Example:alice@google.com?secret=MTIzNDU2Nzg5MDEyMzQ1Njc4OTA&encoding=base64",
+			err:  ErrInvalidSecret,
+		},
+		{
+			desc: "Invalid Base64 secret with the encoding hint should be rejected",
+			uri:  "otpauth://totp/Example:alice@google.com?secret=%2A%2A%2A&encoding=base64",
+			opts: []Option{WithBase64Secrets()},
+			err:  ErrInvalidSecret,
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri, c.opts...)
+		if !errors.Is(err, c.err) || c.err == nil && err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if tk.SecretBase32() != c.secret {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.secret, tk.SecretBase32())
+		}
+		if strings.Contains(tk.String(), "encoding=") {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Encoding hint should not be emitted. Got %q", tk.String())
+		}
+	}
+}
+
+func TestPercentEncodedLabelAndIssuerRoundTrip(t *testing.T) {
+	cases := []struct {
+		desc    string
+		uri     string
+		label   string
+		issuer  string
+		account string
+	}{
+		{
+			desc:    "Spaces should be decoded",
+			uri:     "otpauth://totp/Example%20Inc:alice%20smith?secret=JBSWY3DPEHPK3PXP&issuer=Example%20Inc",
+			label:   "Example Inc:alice smith",
+			issuer:  "Example Inc",
+			account: "alice smith",
+		},
+		{
+			desc:    "Plus in the query parameter should be decoded as a space",
+			uri:     "otpauth://totp/Example%20Inc:alice?secret=JBSWY3DPEHPK3PXP&issuer=Example+Inc",
+			label:   "Example Inc:alice",
+			issuer:  "Example Inc",
+			account: "alice",
+		},
+		{
+			desc:    "Literal plus should be kept",
+			uri:     "otpauth://totp/A%2BB:alice+tag%40example.com?secret=JBSWY3DPEHPK3PXP&issuer=A%2BB",
+			label:   "A+B:alice+tag@example.com",
+			issuer:  "A+B",
+			account: "alice+tag@example.com",
+		},
+		{
+			desc:    "Non-ASCII characters should be decoded",
+			uri:     "otpauth://totp/%E4%BE%8B%E3%81%88:%E3%83%A6%E3%83%BC%E3%82%B6%E3%83%BC?secret=JBSWY3DPEHPK3PXP&issuer=%E4%BE%8B%E3%81%88",
+			label:   "例え:ユーザー",
+			issuer:  "例え",
+			account: "ユーザー",
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if tk.Label() != c.label || tk.Issuer() != c.issuer || tk.AccountName() != c.account {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%q, %q, %q), Actual: (%q, %q, %q)", c.label, c.issuer, c.account, tk.Label(), tk.Issuer(), tk.AccountName())
+			continue
+		}
+
+		rt, err := NewToken(tk.String())
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error for %q: %v", tk.String(), err)
+			continue
+		}
+		if !rt.Equal(tk) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Round trip was lossy. Expected: (%q, %q), Actual: (%q, %q)", tk.Label(), tk.Issuer(), rt.Label(), rt.Issuer())
+		}
+		if strings.Contains(tk.String(), "+") && !strings.Contains(c.label, "+") {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Spaces should be encoded as %%20. Got %q", tk.String())
+		}
+	}
+}
+
+func TestIsExpiringWithin(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	cases := []struct {
+		desc     string
+		time     string
+		d        time.Duration
+		expected bool
+	}{
+		{
+			desc:     "Code with 4 seconds left should be expiring within 5 seconds",
+			time:     "2009-02-13T23:31:56Z",
+			d:        5 * time.Second,
+			expected: true,
+		},
+		{
+			desc:     "Code with exactly 5 seconds left should not be expiring within 5 seconds",
+			time:     "2009-02-13T23:31:55Z",
+			d:        5 * time.Second,
+			expected: false,
+		},
+		{
+			desc:     "Code that has just started should not be expiring",
+			time:     "2009-02-13T23:31:30Z",
+			d:        29 * time.Second,
+			expected: false,
+		},
+		{
+			desc:     "Any code should be expiring within more than the period",
+			time:     "2009-02-13T23:31:30Z",
+			d:        31 * time.Second,
+			expected: true,
+		},
+	}
+	for _, c := range cases {
+		tm, err := time.Parse(time.RFC3339, c.time)
+		if err != nil {
+			t.Fatalf("Invalid time string as RFC 3339 in testcase: %q", c.time)
+		}
+		if actual := tk.IsExpiringWithin(tm, c.d); actual != c.expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.expected, actual)
+		}
+	}
+}
+
+func TestGenerateOffset(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:45Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	for _, steps := range []int{-2, -1, 0, 1, 2} {
+		expected := tk.Generate(tm.Add(time.Duration(steps) * 30 * time.Second))
+		if actual := tk.GenerateOffset(tm, steps); actual != expected {
+			t.Errorf("OTP didn't match for %v steps. Expected: %q, Actual: %q", steps, expected, actual)
+		}
+	}
+	if actual := tk.GenerateOffset(tm, 0); actual != "89005924" {
+		t.Errorf("Expected: %q, Actual: %q", "89005924", actual)
+	}
+}
+
+// lyingHash reports a size large enough for Dynamic Truncation but actually outputs 4 bytes.
+type lyingHash struct {
+	hash.Hash
+}
+
+func (lyingHash) Size() int {
+	return 20
+}
+
+func TestShortHMACOutput(t *testing.T) {
+	if err := RegisterAlgorithm("FNV-64", func() hash.Hash { return fnv.New64() }); !errors.Is(err, ErrInvalidAlgorithm) {
+		t.Errorf("Expected: %v, Actual: %v", ErrInvalidAlgorithm, err)
+	}
+
+	if err := RegisterAlgorithm("LYING-FNV-32", func() hash.Hash { return lyingHash{fnv.New32()} }); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=LYING-FNV-32")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tm := time.Unix(1234567890, 0)
+	if otp := tk.Generate(tm); otp != "" {
+		t.Errorf("OTP should be empty for a short HMAC value. Got %q", otp)
+	}
+	if n := tk.GenerateInt(tm); n != 0 {
+		t.Errorf("OTP should be 0 for a short HMAC value. Got %v", n)
+	}
+	if otp := tk.GenerateSteam(tm); otp != "" {
+		t.Errorf("Steam Guard code should be empty for a short HMAC value. Got %q", otp)
+	}
+	if tk.Verify("", tm) {
+		t.Error("Empty code should not be accepted")
+	}
+}
+
+func FuzzNewToken(f *testing.F) {
+	seeds := []string{
+		"otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"otpauth://totp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&algorithm=SHA512&digits=8&period=60",
+		"otpauth://hotp/Example:alice@google.com?secret=JBSWY3DPEHPK3PXP&counter=42",
+		"otpauth://totp/%E4%BE%8B%E3%81%88:%2Fhome?secret=GEZD-GNBV%20GY3T&image=https%3A%2F%2Fexample.com%2Flogo.png",
+		"otpauth://totp/?secret=&digits=abc&period=-1",
+		"otpauth://motp/Example?secret=JBSWY3DPEHPK3PXP",
+		"http://totp/Example?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://totp/Example:alice?secret=JBSWY3DPEHPK3PXP&issuer=Other",
+		"%",
+		"",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, uri string) {
+		tk, err := NewToken(uri)
+		if err != nil {
+			return
+		}
+		if err := tk.Valid(); err != nil {
+			t.Errorf("Token parsed from %q is invalid: %v", uri, err)
+		}
+		tk.Generate(time.Unix(1234567890, 0))
+		if _, err := NewToken(tk.String()); err != nil {
+			t.Errorf("Key URI %q of token parsed from %q cannot be parsed: %v", tk.String(), uri, err)
+		}
+	})
+}
+
+func TestEstimateDrift(t *testing.T) {
+	tk, err := NewToken("otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:45Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	cases := []struct {
+		desc     string
+		offset   time.Duration
+		maxSteps int
+		drift    time.Duration
+		ok       bool
+	}{
+		{
+			desc:     "Client in sync should have no drift",
+			maxSteps: 2,
+			drift:    0,
+			ok:       true,
+		},
+		{
+			desc:     "Client one period ahead should have positive drift",
+			offset:   30 * time.Second,
+			maxSteps: 2,
+			drift:    30 * time.Second,
+			ok:       true,
+		},
+		{
+			desc:     "Client behind should have negative drift",
+			offset:   -65 * time.Second,
+			maxSteps: 2,
+			drift:    -60 * time.Second,
+			ok:       true,
+		},
+		{
+			desc:     "Client beyond the window should not match",
+			offset:   -90 * time.Second,
+			maxSteps: 2,
+			ok:       false,
+		},
+	}
+	for _, c := range cases {
+		code := tk.Generate(tm.Add(c.offset))
+		drift, ok := tk.EstimateDrift(code, tm, c.maxSteps)
+		if drift != c.drift || ok != c.ok {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: (%v, %v), Actual: (%v, %v)", c.drift, c.ok, drift, ok)
+		}
+	}
+}
+
+// errReader fails on every read.
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("Broken reader")
+}
+
+func TestNewTokenFromSecretReader(t *testing.T) {
+	tk, err := NewTokenFromSecretReader(strings.NewReader("12345678901234567890"), WithDigits(8))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if otp := tk.Generate(time.Unix(1234567890, 0)); otp != "89005924" {
+		t.Errorf("Expected: %q, Actual: %q", "89005924", otp)
+	}
+
+	cases := []struct {
+		desc string
+		r    io.Reader
+		err  error
+	}{
+		{
+			desc: "Empty secret should be rejected",
+			r:    strings.NewReader(""),
+			err:  ErrMissingSecret,
+		},
+		{
+			desc: "Too long secret should be rejected",
+			r:    strings.NewReader(strings.Repeat("0", 1025)),
+			err:  ErrInvalidSecret,
+		},
+	}
+	for _, c := range cases {
+		if _, err := NewTokenFromSecretReader(c.r); !errors.Is(err, c.err) {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %v, Actual: %v", c.err, err)
+		}
+	}
+	if _, err := NewTokenFromSecretReader(strings.NewReader(strings.Repeat("0", 1024))); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	if _, err := NewTokenFromSecretReader(errReader{}); err == nil {
+		t.Error("Expected an error for a broken reader but didn't get one")
+	}
+}
+
+func TestExportedBounds(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	for _, digits := range []int{DigitsMin, DigitsMax} {
+		if _, err := NewTokenFromParams(secret, WithDigits(digits)); err != nil {
+			t.Errorf("Got unexpected error for digits %v: %v", digits, err)
+		}
+	}
+	for _, digits := range []int{DigitsMin - 1, DigitsMax + 1} {
+		if _, err := NewTokenFromParams(secret, WithDigits(digits)); !errors.Is(err, ErrDigitsOutOfRange) {
+			t.Errorf("Expected: %v for digits %v, Actual: %v", ErrDigitsOutOfRange, digits, err)
+		}
+	}
+	for _, period := range []int{PeriodMin, PeriodMax} {
+		if _, err := NewTokenFromParams(secret, WithPeriod(period)); err != nil {
+			t.Errorf("Got unexpected error for period %v: %v", period, err)
+		}
+	}
+	for _, period := range []int{PeriodMin - 1, PeriodMax + 1} {
+		if _, err := NewTokenFromParams(secret, WithPeriod(period)); !errors.Is(err, ErrPeriodOutOfRange) {
+			t.Errorf("Expected: %v for period %v, Actual: %v", ErrPeriodOutOfRange, period, err)
+		}
+	}
+}
+
+func TestWithMaxPeriod(t *testing.T) {
+	uriTpl := "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&period=%v"
+	cases := []struct {
+		desc   string
+		period int
+		max    int
+		ok     bool
+	}{
+		{"Period of 120 should be rejected by default", 120, 0, false},
+		{"Period of 120 should be accepted with max period 300", 120, 300, true},
+		{"Period of 300 should be accepted with max period 300", 300, 300, true},
+		{"Period of 301 should be rejected with max period 300", 301, 300, false},
+		{"Period of 0 should be rejected with max period 300", 0, 300, false},
+	}
+	for _, c := range cases {
+		var opts []Option
+		if c.max != 0 {
+			opts = append(opts, WithMaxPeriod(c.max))
+		}
+		tk, err := NewToken(fmt.Sprintf(uriTpl, c.period), opts...)
+		if !c.ok {
+			if !errors.Is(err, ErrPeriodOutOfRange) {
+				t.Errorf("[CASE] %v", c.desc)
+				t.Errorf("Expected: %v, Actual: %v", ErrPeriodOutOfRange, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if tk.Period() != c.period || tk.Valid() != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected a valid token with period %v. Got %v: %v", c.period, tk.Period(), tk.Valid())
+		}
+		// The token survives a round trip through JSON.
+		data, err := tk.MarshalJSON()
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		var other Token
+		if err := other.UnmarshalJSON(data); err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+		}
+	}
+
+	secret := []byte("12345678901234567890")
+	if _, err := NewTokenFromParams(secret, WithPeriod(300)); !errors.Is(err, ErrPeriodOutOfRange) {
+		t.Errorf("Expected: %v, Actual: %v", ErrPeriodOutOfRange, err)
+	}
+	// WithMaxPeriod can be given after WithPeriod.
+	if _, err := NewTokenFromParams(secret, WithPeriod(300), WithMaxPeriod(300)); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	if _, err := NewTokenFromParams(secret, WithPeriodDuration(5*time.Minute), WithMaxPeriod(300)); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+
+	// The setter and a round trip through text honor the widened bound.
+	tk, err := NewTokenFromParams(secret, WithMaxPeriod(300), WithPeriod(300))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if err := tk.SetPeriod(200); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	if err := tk.SetPeriod(301); !errors.Is(err, ErrPeriodOutOfRange) {
+		t.Errorf("Expected: %v, Actual: %v", ErrPeriodOutOfRange, err)
+	}
+	text, err := tk.MarshalText()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	var rt Token
+	if err := rt.UnmarshalText(text); err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if !rt.Equal(tk) {
+		t.Errorf("Round-tripped token differs. Expected: %q, Actual: %q", tk.String(), rt.String())
+	}
+	// The restored token admits its own period, but no longer one.
+	if err := rt.SetPeriod(200); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	if err := rt.SetPeriod(201); !errors.Is(err, ErrPeriodOutOfRange) {
+		t.Errorf("Expected: %v, Actual: %v", ErrPeriodOutOfRange, err)
+	}
+	if _, err := NewToken(tk.String(), WithMaxPeriod(300)); err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	for _, max := range []int{-1, 0, 45} {
+		if _, err := NewTokenFromParams(secret, WithMaxPeriod(max)); err == nil {
+			t.Errorf("Expected an error for max period %v but didn't get one", max)
+		}
+	}
+}
+
+func TestWithEpoch(t *testing.T) {
+	epoch, err := time.Parse(time.RFC3339, "2001-09-09T01:46:40Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	tk, err := NewTokenFromParams([]byte("12345678901234567890"), WithDigits(8), WithEpoch(epoch.Add(15*time.Second)))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	// 59 seconds after T0 is the same counter as RFC 6238's first vector.
+	m := epoch.Add(74 * time.Second)
+	if otp := tk.Generate(m); otp != "94287082" {
+		t.Errorf("Expected: %q, Actual: %q", "94287082", otp)
+	}
+	if counter := tk.Counter(m); counter != 1 {
+		t.Errorf("Expected: %v, Actual: %v", 1, counter)
+	}
+	if start := tk.PeriodStart(m); !start.Equal(epoch.Add(45 * time.Second)) {
+		t.Errorf("Expected: %v, Actual: %v", epoch.Add(45*time.Second), start)
+	}
+	if end := tk.PeriodEnd(m); !end.Equal(epoch.Add(75 * time.Second)) {
+		t.Errorf("Expected: %v, Actual: %v", epoch.Add(75*time.Second), end)
+	}
+	if remaining := tk.TimeRemaining(m); remaining != time.Second {
+		t.Errorf("Expected: %v, Actual: %v", time.Second, remaining)
+	}
+	// Times before T0 have negative counters.
+	if counter := tk.Counter(epoch); counter != -1 {
+		t.Errorf("Expected: %v, Actual: %v", -1, counter)
+	}
+
+	if _, err := NewTokenFromParams([]byte("12345678901234567890"), WithEpoch(epoch.Add(time.Millisecond))); err == nil {
+		t.Error("Expected an error for an epoch with a fraction of a second but didn't get one")
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	// The intermediate HMAC value for count 1 listed in RFC 4226 Appendix D.
+	tk, err := NewTokenFromParams([]byte("12345678901234567890"))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	tm, err := time.Parse(time.RFC3339, "1970-01-01T00:00:59Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	expected := "75a48a19d4cbe100644e8ac1397eea747a2d33ab"
+	if actual := hex.EncodeToString(tk.HMAC(tm)); actual != expected {
+		t.Errorf("Expected: %q, Actual: %q", expected, actual)
+	}
+
+	tk.Destroy()
+	if mac := tk.HMAC(tm); mac != nil {
+		t.Errorf("HMAC should be nil after Destroy. Got %x", mac)
+	}
+}
+
+func TestGenerateFormatted(t *testing.T) {
+	tm, err := time.Parse(time.RFC3339, "2009-02-13T23:31:30Z")
+	if err != nil {
+		t.Fatalf("Invalid time string as RFC 3339: %v", err)
+	}
+	cases := []struct {
+		desc      string
+		uri       string
+		groupSize int
+		sep       string
+		expected  string
+	}{
+		{
+			desc:      "6 digits should be split in halves",
+			uri:       "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			groupSize: 3,
+			sep:       " ",
+			expected:  "005 924",
+		},
+		{
+			desc:      "Last group might be shorter",
+			uri:       "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8",
+			groupSize: 3,
+			sep:       "-",
+			expected:  "890-059-24",
+		},
+		{
+			desc:      "Zero group size should return the raw code",
+			uri:       "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8",
+			groupSize: 0,
+			sep:       " ",
+			expected:  "89005924",
+		},
+		{
+			desc:      "Group size not less than the length should return the raw code",
+			uri:       "otpauth://totp/exampleservice:exampleuser?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			groupSize: 6,
+			sep:       " ",
+			expected:  "005924",
+		},
+	}
+	for _, c := range cases {
+		tk, err := NewToken(c.uri)
+		if err != nil {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Got unexpected error: %v", err)
+			continue
+		}
+		if actual := tk.GenerateFormatted(tm, c.groupSize, c.sep); actual != c.expected {
+			t.Errorf("[CASE] %v", c.desc)
+			t.Errorf("Expected: %q, Actual: %q", c.expected, actual)
+		}
+	}
+}